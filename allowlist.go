@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Reasons of the rejected targets, used as the reason label of probe_target_rejected_total.
+const (
+	schemeRejection = "scheme"
+	portRejection   = "port"
+	hostRejection   = "host"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// TargetAllowlist restricts the targets which can be probed. Every list which is empty allows everything.
+type TargetAllowlist struct {
+	// Globs of the allowed host names as accepted by path.Match, e.g. *.shop.internal.
+	Hosts []string `yaml:"hosts,omitempty"`
+	// Allowed networks, e.g. 10.0.0.0/8. Host names which don't match Hosts must resolve to these networks.
+	CIDRs   []string `yaml:"cidrs,omitempty"`
+	Schemes []string `yaml:"schemes,omitempty"`
+	// Allowed ports, the default port of the scheme is used if the target has no port.
+	Ports []int `yaml:"ports,omitempty"`
+
+	networks []*net.IPNet
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *TargetAllowlist) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TargetAllowlist
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	for _, host := range s.Hosts {
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("invalid host glob %q: %s", host, err)
+		}
+	}
+	for _, cidr := range s.CIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		s.networks = append(s.networks, network)
+	}
+	for _, port := range s.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port: %d", port)
+		}
+	}
+	return nil
+}
+
+// targetRejection is the error of a target which is not allowed.
+type targetRejection struct {
+	reason string
+	err    error
+}
+
+func (r *targetRejection) Error() string {
+	return r.err.Error()
+}
+
+// asTargetRejection returns the rejection of the target if the error of a request is caused by the allowlist.
+func asTargetRejection(err error) (*targetRejection, bool) {
+	for {
+		switch e := err.(type) {
+		case *targetRejection:
+			return e, true
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		default:
+			return nil, false
+		}
+	}
+}
+
+func reject(reason string, format string, a ...interface{}) error {
+	return &targetRejection{reason: reason, err: fmt.Errorf(format, a...)}
+}
+
+// check returns a *targetRejection if the target is not allowed. Host names which are not allowed by
+// a glob are resolved and all their addresses must be in the allowed networks.
+func (s TargetAllowlist) check(ctx context.Context, target *url.URL) error {
+	scheme := strings.ToLower(target.Scheme)
+	if len(s.Schemes) > 0 && !containsFold(s.Schemes, scheme) {
+		return reject(schemeRejection, "scheme %q is not allowed", scheme)
+	}
+
+	port := target.Port()
+	if port == "" {
+		port = defaultPorts[scheme]
+	}
+	if len(s.Ports) > 0 && !s.allowsPort(port) {
+		return reject(portRejection, "port %q is not allowed", port)
+	}
+
+	host := strings.ToLower(target.Hostname())
+	if (len(s.Hosts) == 0 && len(s.networks) == 0) || s.matchesHost(host) {
+		return nil
+	}
+	if len(s.networks) == 0 {
+		return reject(hostRejection, "host %q is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !s.allowsIP(ip) {
+			return reject(hostRejection, "address %s is not allowed", ip)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return reject(hostRejection, "can't resolve host %q: %s", host, err)
+	}
+	for _, addr := range addrs {
+		if !s.allowsIP(addr.IP) {
+			return reject(hostRejection, "host %q resolves to %s which is not allowed", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+func (s TargetAllowlist) matchesHost(host string) bool {
+	for _, glob := range s.Hosts {
+		if ok, _ := path.Match(strings.ToLower(glob), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s TargetAllowlist) allowsPort(port string) bool {
+	for _, allowed := range s.Ports {
+		if strconv.Itoa(allowed) == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (s TargetAllowlist) allowsIP(ip net.IP) bool {
+	for _, network := range s.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialContext checks the address of the connection again, so that a host name which resolved to an allowed
+// address during the check can't resolve to another address when the connection is made.
+func (s TargetAllowlist) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	checked := *dialer
+	checked.Control = func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !s.allowsIP(ip) {
+			return reject(hostRejection, "address %s is not allowed", host)
+		}
+		return nil
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && s.matchesHost(strings.ToLower(host)) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
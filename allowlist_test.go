@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newAllowlist(t *testing.T, config string) TargetAllowlist {
+	var allowlist TargetAllowlist
+	if err := yaml.UnmarshalStrict([]byte(config), &allowlist); err != nil {
+		t.Fatal(err)
+	}
+	return allowlist
+}
+
+func TestTargetAllowlist_check(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		config string
+		target string
+		reason string
+	}
+
+	tests := []testpair{
+		{"{}", "http://169.254.169.254/latest/meta-data", ""},
+		{"schemes: [https]", "https://status.shop.internal", ""},
+		{"schemes: [https]", "HTTPS://status.shop.internal", ""},
+		{"schemes: [https]", "http://status.shop.internal", schemeRejection},
+		{"ports: [8081, 443]", "http://status.shop.internal:8081/status", ""},
+		{"ports: [8081, 443]", "https://status.shop.internal/status", ""},
+		{"ports: [8081, 443]", "http://status.shop.internal/status", portRejection},
+		{"ports: [8081, 443]", "http://status.shop.internal:22", portRejection},
+		{"hosts: ['*.shop.internal']", "http://catalog.shop.internal:8081", ""},
+		{"hosts: ['*.shop.internal']", "http://Catalog.Shop.Internal:8081", ""},
+		{"hosts: ['*.shop.internal']", "http://shop.internal:8081", hostRejection},
+		{"hosts: ['*.shop.internal']", "http://10.0.0.5:8081", hostRejection},
+		{"cidrs: [10.0.0.0/8]", "http://10.0.0.5:8081", ""},
+		{"cidrs: [10.0.0.0/8]", "http://192.168.0.5:8081", hostRejection},
+		{"cidrs: [10.0.0.0/8, 'fd00::/8']", "http://[fd00::5]:8081", ""},
+		{"cidrs: [127.0.0.0/8, '::1/128']", "http://localhost:8081", ""},
+		{"cidrs: [10.0.0.0/8]", "http://localhost:8081", hostRejection},
+		{"{hosts: ['*.shop.internal'], cidrs: [10.0.0.0/8]}", "http://catalog.shop.internal", ""},
+		{"{hosts: ['*.shop.internal'], cidrs: [10.0.0.0/8]}", "http://10.1.2.3", ""},
+		{"{hosts: ['*.shop.internal'], cidrs: [10.0.0.0/8]}", "http://127.0.0.1", hostRejection},
+	}
+
+	for _, test := range tests {
+		target, err := url.Parse(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = newAllowlist(t, test.config).check(context.Background(), target)
+		if test.reason == "" {
+			assert.NoError(err, "target %s with %s", test.target, test.config)
+			continue
+		}
+		rejection, ok := asTargetRejection(err)
+		assert.True(ok, "target %s with %s should be rejected, got: %v", test.target, test.config, err)
+		if ok {
+			assert.Equal(test.reason, rejection.reason, "target %s with %s", test.target, test.config)
+		}
+	}
+}
+
+func TestTargetAllowlist_dialContext(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	dialer := &net.Dialer{Timeout: time.Second}
+
+	conn, err := newAllowlist(t, "cidrs: [127.0.0.0/8]").dialContext(dialer)(context.Background(), "tcp", listener.Addr().String())
+	assert.NoError(err)
+	if err == nil {
+		conn.Close()
+	}
+
+	_, err = newAllowlist(t, "cidrs: [10.0.0.0/8]").dialContext(dialer)(context.Background(), "tcp", listener.Addr().String())
+	rejection, ok := asTargetRejection(err)
+	assert.True(ok, "connection to an address which is not allowed should be rejected, got: %v", err)
+	if ok {
+		assert.Equal(hostRejection, rejection.reason)
+	}
+}
+
+func TestTargetAllowlist_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, config := range []string{"cidrs: [10.0.0.0/33]", "cidrs: [shop.internal]", "ports: [0]", "ports: [65536]", "hosts: ['[a-']"} {
+		var allowlist TargetAllowlist
+		assert.Error(yaml.UnmarshalStrict([]byte(config), &allowlist), "config: %s", config)
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultModuleName = "default"
+
+// Config is the root of the configuration file passed via --config.file.
+type Config struct {
+	Modules map[string]Module `yaml:"modules"`
+	// Targets which can be probed, all targets are allowed if it's empty.
+	TargetAllowlist TargetAllowlist `yaml:"target_allowlist,omitempty"`
+}
+
+// Module is a named set of probe settings, selected via the 'module' parameter of /probe.
+type Module struct {
+	// Timeout of the probe, CS_CONNECTION_TIMEOUT is used when it's not set.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	HTTP    HTTPProbe     `yaml:"http,omitempty"`
+	// Format of the CommonStatus page, detected by the Content-Type of the response when it's not set.
+	Format     InputFormat      `yaml:"format,omitempty"`
+	JSON       JSONConfig       `yaml:"json,omitempty"`
+	Conversion ConversionConfig `yaml:"conversion,omitempty"`
+}
+
+// HTTPProbe configures the HTTP client used to fetch the CommonStatus page.
+type HTTPProbe struct {
+	// Accepted status codes, defaults to 200 only.
+	ValidStatusCodes  []int      `yaml:"valid_status_codes,omitempty"`
+	NoFollowRedirects bool       `yaml:"no_follow_redirects,omitempty"`
+	TLSConfig         TLSConfig  `yaml:"tls_config,omitempty"`
+	BasicAuth         *BasicAuth `yaml:"basic_auth,omitempty"`
+	// File with the bearer token sent in the Authorization header, it's read for every probe.
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+	// Additional headers of the request.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// BasicAuth configures the basic authentication of the request.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	// File with the password, it's read for every probe.
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// ConversionConfig configures how CommonStatus lines are converted to prometheus metrics.
+type ConversionConfig struct {
+	// Lines matching any of these expressions are skipped and not counted as failed.
+	IgnoreLines []Regexp `yaml:"ignore_lines,omitempty"`
+	// User-defined rules, they are tried before the built-in converters.
+	Rules           []ConversionRule      `yaml:"rules,omitempty"`
+	RunningAverages RunningAveragesConfig `yaml:"running_averages,omitempty"`
+	StartupTime     StartupTimeConfig     `yaml:"startup_time,omitempty"`
+	Info            InfoConfig            `yaml:"info,omitempty"`
+	Memory          MemoryConfig          `yaml:"memory,omitempty"`
+	KeyValue        KeyValueConfig        `yaml:"key_value,omitempty"`
+	Sections        SectionsConfig        `yaml:"sections,omitempty"`
+	// Kinds of values parsed in addition to plain numbers.
+	Values ValuesConfig `yaml:"values,omitempty"`
+	// Types, help and units of the metrics converted by the default converter.
+	Metadata []MetricMetadata `yaml:"metadata,omitempty"`
+	// Names of the registered converters which are not used by the module.
+	DisabledConverters []string `yaml:"disabled_converters,omitempty"`
+}
+
+// RunningAveragesConfig configures the conversion of RunningAverages lines.
+type RunningAveragesConfig struct {
+	// Convert MethodRuntime_<class>.<method> and MethodRunTime_ByClass_<class> names
+	// to method_runtime and method_runtime_by_class metrics with class and method labels.
+	SplitMethodNames bool `yaml:"split_method_names,omitempty"`
+	// Emit count and total duration as a summary <name>_seconds instead of <name>_total and <name>_seconds_total.
+	Summary bool `yaml:"summary,omitempty"`
+	// Export averageEventRate, maxEventRate and maxValue fields as gauges.
+	KeepAllFields bool `yaml:"keep_all_fields,omitempty"`
+	// Unit of the values, defaults to milliseconds.
+	Unit Unit `yaml:"unit,omitempty"`
+	// Units of the values of metrics with specific name prefixes, the first matching prefix wins.
+	Units []UnitPrefix `yaml:"units,omitempty"`
+}
+
+// ValuesConfig enables the kinds of values parsed by the default converter and the conversion rules.
+type ValuesConfig struct {
+	// Durations like 12ms or 1h30m are converted to seconds.
+	Durations bool `yaml:"durations,omitempty"`
+	// Sizes like 1.2 GB or 512KiB are converted to bytes.
+	Sizes bool `yaml:"sizes,omitempty"`
+	// Percentages like 93.5% are converted to ratios.
+	Percentages bool `yaml:"percentages,omitempty"`
+	// true/false, yes/no and on/off are converted to 1 and 0.
+	Booleans bool `yaml:"booleans,omitempty"`
+	// Separators of numbers: en (1,234.5), de or eu (1.234,5), ch (1'234.5) or si (1 234.5 with thin spaces).
+	// Defaults to en.
+	Locale string `yaml:"locale,omitempty"`
+	// Override the separators of the locale.
+	DecimalSeparator  string `yaml:"decimal_separator,omitempty"`
+	GroupingSeparator string `yaml:"grouping_separator,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *ValuesConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ValuesConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if _, ok := numberFormats[s.Locale]; s.Locale != "" && !ok {
+		return fmt.Errorf("unknown locale: %s", s.Locale)
+	}
+	for _, sep := range []string{s.DecimalSeparator, s.GroupingSeparator} {
+		if len([]rune(sep)) > 1 || (sep != "" && isDigits(sep)) {
+			return fmt.Errorf("invalid number separator: %q", sep)
+		}
+	}
+	format := s.numberFormat()
+	for _, grouping := range format.grouping {
+		if grouping == format.decimal {
+			return fmt.Errorf("decimal and grouping separators must be different: %q", grouping)
+		}
+	}
+	return nil
+}
+
+// numberFormat returns the number format of the locale with the overridden separators.
+func (s ValuesConfig) numberFormat() numberFormat {
+	format, ok := numberFormats[s.Locale]
+	if !ok {
+		format = defaultNumberFormat
+	}
+	if s.DecimalSeparator != "" {
+		format.decimal = s.DecimalSeparator
+	}
+	if s.GroupingSeparator != "" {
+		format.grouping = []string{s.GroupingSeparator}
+	}
+	return format
+}
+
+// InfoConfig configures the labels of the commonstatus_info metric.
+type InfoConfig struct {
+	// Keys of the string-valued lines added as labels in addition to ReleaseTag.
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *InfoConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain InfoConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	labels := map[string]string{infoLabelName("ReleaseTag"): "ReleaseTag"}
+	for _, key := range s.Keys {
+		label := infoLabelName(key)
+		if !labelName.MatchString(label) || strings.HasPrefix(label, "__") {
+			return fmt.Errorf("info key %q is not a valid label name: %q", key, label)
+		}
+		if other, ok := labels[label]; ok {
+			return fmt.Errorf("info keys %q and %q have the same label name: %q", other, key, label)
+		}
+		labels[label] = key
+	}
+	return nil
+}
+
+// MemoryConfig configures the conversion of the MemoryUsed and MemoryMax lines.
+type MemoryConfig struct {
+	// Value of the area label of the memory metrics, e.g. heap. The label is omitted if it's empty.
+	Area string `yaml:"area,omitempty"`
+}
+
+// SectionsConfig configures the labels of the lines under [Section] headers and in indented blocks.
+type SectionsConfig struct {
+	// Name of the label which holds the section, defaults to section.
+	Label string `yaml:"label,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *SectionsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain SectionsConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Label != "" && !labelName.MatchString(s.Label) {
+		return fmt.Errorf("invalid section label name: %q", s.Label)
+	}
+	return nil
+}
+
+// KeyValueConfig configures the conversion of "Name: k1=v1 k2=v2" lines.
+type KeyValueConfig struct {
+	// Name of the label which holds the field name of a single Name metric.
+	// Every field is converted to its own Name_<field> metric if it's empty.
+	FieldLabel string `yaml:"field_label,omitempty"`
+	// Types of the fields, the first map matching the name of the line wins. Unknown fields are gauges.
+	FieldMaps []FieldMap `yaml:"field_maps,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *KeyValueConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain KeyValueConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.FieldLabel != "" && !labelName.MatchString(s.FieldLabel) {
+		return fmt.Errorf("invalid field label name: %q", s.FieldLabel)
+	}
+	return nil
+}
+
+// typeOf returns the type of the field of the line with the name.
+func (s KeyValueConfig) typeOf(name, field string) MetricType {
+	for _, m := range s.FieldMaps {
+		if m.Match.Regexp != nil && !m.Match.MatchString(name) {
+			continue
+		}
+		if t, ok := m.Fields[field]; ok {
+			return t
+		}
+	}
+	return GaugeMetricType
+}
+
+// FieldMap defines the types of the fields of the lines matching a regular expression.
+type FieldMap struct {
+	// Regular expression matching the name of the line, the map applies to all lines if it's empty.
+	Match  Regexp                `yaml:"match,omitempty"`
+	Fields map[string]MetricType `yaml:"fields"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (m *FieldMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FieldMap
+	if err := unmarshal((*plain)(m)); err != nil {
+		return err
+	}
+	for field, t := range m.Fields {
+		if t != CounterMetricType && t != GaugeMetricType {
+			return fmt.Errorf("field %q must be a counter or a gauge, got %s", field, t)
+		}
+	}
+	return nil
+}
+
+// StartupTimeConfig configures the conversion of the StartupTime line.
+type StartupTimeConfig struct {
+	// Also export the app_uptime_seconds_total counter computed at the time of the probe.
+	ExportUptime bool `yaml:"export_uptime,omitempty"`
+	// Layouts of the time as accepted by time.Parse, tried in order. Defaults to time.UnixDate.
+	Layouts []string `yaml:"layouts,omitempty"`
+	// Location of times without a zone or with an unknown zone abbreviation, defaults to UTC.
+	Location Location `yaml:"location,omitempty"`
+	// Locations of the zone abbreviations, e.g. CET: Europe/Berlin.
+	ZoneAbbreviations map[string]Location `yaml:"zone_abbreviations,omitempty"`
+}
+
+// Location encapsulates a time.Location and makes it YAML (un)marshalable by its IANA name.
+type Location struct {
+	*time.Location
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (l *Location) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return fmt.Errorf("unknown location %q: %s", s, err)
+	}
+	l.Location = loc
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (l Location) MarshalYAML() (interface{}, error) {
+	if l.Location == nil {
+		return nil, nil
+	}
+	return l.String(), nil
+}
+
+func (s StartupTimeConfig) location() *time.Location {
+	if s.Location.Location == nil {
+		return time.UTC
+	}
+	return s.Location.Location
+}
+
+func (s StartupTimeConfig) layouts() []string {
+	if len(s.Layouts) == 0 {
+		return []string{time.UnixDate}
+	}
+	return s.Layouts
+}
+
+// UnitPrefix sets the unit of the metrics which names start with the prefix.
+type UnitPrefix struct {
+	Prefix string `yaml:"prefix"`
+	Unit   Unit   `yaml:"unit"`
+}
+
+// Unit is a unit of the values reported by CommonStatus.
+type Unit string
+
+// Supported units, time units are converted to seconds.
+const (
+	NanosecondsUnit  Unit = "ns"
+	MicrosecondsUnit Unit = "us"
+	MillisecondsUnit Unit = "ms"
+	SecondsUnit      Unit = "s"
+	BytesUnit        Unit = "bytes"
+	NoneUnit         Unit = "none"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (u *Unit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch unit := Unit(s); unit {
+	case NanosecondsUnit, MicrosecondsUnit, MillisecondsUnit, SecondsUnit, BytesUnit, NoneUnit:
+		*u = unit
+		return nil
+	default:
+		return fmt.Errorf("unknown unit: %s", s)
+	}
+}
+
+// divisor converts a value of the unit to the base unit of prometheus.
+func (u Unit) divisor() float64 {
+	switch u {
+	case NanosecondsUnit:
+		return 1e9
+	case MicrosecondsUnit:
+		return 1e6
+	case SecondsUnit, BytesUnit, NoneUnit:
+		return 1
+	default:
+		return 1e3
+	}
+}
+
+// suffix is the base unit suffix of the metric names.
+func (u Unit) suffix() string {
+	switch u {
+	case BytesUnit:
+		return "_bytes"
+	case NoneUnit:
+		return "_value"
+	default:
+		return "_seconds"
+	}
+}
+
+// quantity is used in the help of the metrics.
+func (u Unit) quantity() string {
+	switch u {
+	case BytesUnit:
+		return "size"
+	case NoneUnit:
+		return "value"
+	default:
+		return "duration"
+	}
+}
+
+// unitOf returns the unit of the metric with the given CommonStatus name.
+func (s RunningAveragesConfig) unitOf(name string) Unit {
+	for _, u := range s.Units {
+		if strings.HasPrefix(name, u.Prefix) {
+			return u.Unit
+		}
+	}
+	if s.Unit == "" {
+		return MillisecondsUnit
+	}
+	return s.Unit
+}
+
+// Regexp encapsulates a regexp.Regexp and makes it YAML (un)marshalable.
+// The expression is anchored on both sides.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp creates a new anchored Regexp and returns an error if the expression can't be compiled.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp works like NewRegexp, but panics if the expression can't be compiled.
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	return re.original, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if len(s.Modules) == 0 {
+		return fmt.Errorf("no modules defined")
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *Module) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Module
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative: %s", s.Timeout)
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *HTTPProbe) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HTTPProbe
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	for _, code := range s.ValidStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid HTTP status code: %d", code)
+		}
+	}
+	if s.BasicAuth != nil && s.BearerTokenFile != "" {
+		return fmt.Errorf("at most one of basic_auth and bearer_token_file must be configured")
+	}
+	for name := range s.Headers {
+		if http.CanonicalHeaderKey(name) == "Authorization" && (s.BasicAuth != nil || s.BearerTokenFile != "") {
+			return fmt.Errorf("the Authorization header must not be set together with basic_auth or bearer_token_file")
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *BasicAuth) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain BasicAuth
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Username == "" {
+		return fmt.Errorf("basic_auth is missing 'username'")
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *ConversionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ConversionConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	for _, name := range s.DisabledConverters {
+		if !isRegisteredConverter(name) {
+			return fmt.Errorf("unknown converter in disabled_converters: %s", name)
+		}
+	}
+	return nil
+}
+
+// defaultConfig is used when no configuration file is given, it preserves the env-only behaviour.
+func defaultConfig() *Config {
+	return &Config{
+		Modules: map[string]Module{
+			defaultModuleName: {},
+		},
+	}
+}
+
+// SafeConfig guards the configuration which can be replaced at runtime by a reload.
+type SafeConfig struct {
+	sync.RWMutex
+	C *Config
+}
+
+// ReloadConfig loads and validates the config file, the current configuration is kept if it fails.
+func (sc *SafeConfig) ReloadConfig(file string) error {
+	c, err := loadConfig(file)
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	sc.Lock()
+	sc.C = c
+	sc.Unlock()
+
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+// UseDefaultConfig activates the built-in default config, it counts as a successful reload.
+func (sc *SafeConfig) UseDefaultConfig() {
+	sc.Lock()
+	sc.C = defaultConfig()
+	sc.Unlock()
+
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+}
+
+// Module returns a module of the current configuration by its name.
+func (sc *SafeConfig) Module(name string) (Module, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	module, ok := sc.C.Modules[name]
+	return module, ok
+}
+
+// Allowlist returns the allowlist of the targets.
+func (sc *SafeConfig) Allowlist() TargetAllowlist {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C.TargetAllowlist
+}
+
+func loadConfig(file string) (*Config, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %s", err)
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %s", err)
+	}
+	return c, nil
+}
+
+func (s HTTPProbe) validStatusCodes() []int {
+	if len(s.ValidStatusCodes) == 0 {
+		return []int{200}
+	}
+	return s.ValidStatusCodes
+}
+
+// authorize adds the configured headers and credentials to the request. The secrets are read from
+// their files, errors only mention the files and never the secrets.
+func (s HTTPProbe) authorize(req *http.Request) error {
+	for name, value := range s.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if s.BasicAuth != nil {
+		password := ""
+		if s.BasicAuth.PasswordFile != "" {
+			b, err := ioutil.ReadFile(s.BasicAuth.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("can't read the password file: %v", err)
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		req.SetBasicAuth(s.BasicAuth.Username, password)
+	}
+	if s.BearerTokenFile != "" {
+		b, err := ioutil.ReadFile(s.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("can't read the bearer token file: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// isValidStatusCode reports whether the response status code is accepted by the module.
+func (s HTTPProbe) isValidStatusCode(code int) bool {
+	for _, valid := range s.validStatusCodes() {
+		if code == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnored reports whether the line should be skipped by the module.
+func (s ConversionConfig) isIgnored(line string) bool {
+	for _, re := range s.IgnoreLines {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDisabled reports whether the converter is disabled by the module.
+func (s ConversionConfig) isDisabled(name string) bool {
+	for _, disabled := range s.DisabledConverters {
+		if name == disabled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := loadConfig("testdata/config_good.yml")
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	assert.Len(c.Modules, 3)
+	assert.Equal(5*time.Second, c.Modules["default"].Timeout)
+
+	catalog := c.Modules["catalog"]
+	assert.Equal(10*time.Second, catalog.Timeout)
+	assert.True(catalog.HTTP.NoFollowRedirects)
+	assert.True(catalog.HTTP.isValidStatusCode(203))
+	assert.False(catalog.HTTP.isValidStatusCode(201))
+	assert.True(catalog.Conversion.isIgnored("VeryLongActive: 0"))
+	assert.True(catalog.Conversion.isIgnored("DebugFlag: 1"))
+	assert.False(catalog.Conversion.isIgnored("ThreadCount: 3009"))
+	assert.Len(catalog.Conversion.Rules, 1)
+	assert.Equal(GaugeMetricType, catalog.Conversion.Rules[0].Type)
+	assert.Equal(map[string]string{"pool": "$pool"}, catalog.Conversion.Rules[0].Labels)
+	assert.Equal("field", catalog.Conversion.KeyValue.FieldLabel)
+	assert.Equal(CounterMetricType, catalog.Conversion.KeyValue.typeOf("Cache_Products", "hits"))
+	assert.Equal(GaugeMetricType, catalog.Conversion.KeyValue.typeOf("Cache_Products", "ratio"))
+	assert.Equal(GaugeMetricType, catalog.Conversion.KeyValue.typeOf("Queue", "hits"))
+
+	assert.Equal([]string{"*.shop.internal"}, c.TargetAllowlist.Hosts)
+	assert.Len(c.TargetAllowlist.networks, 1)
+
+	assert.True(c.Modules["no_load_avg"].Conversion.isDisabled("load_avg"))
+	assert.False(c.Modules["no_load_avg"].Conversion.isDisabled("startup_time"))
+}
+
+func TestLoadConfig_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"testdata/config_invalid_regexp.yml", "error parsing regexp"},
+		{"testdata/config_unknown_field.yml", "field timout not found"},
+		{"testdata/config_no_modules.yml", "no modules defined"},
+		{"testdata/config_unknown_location.yml", `unknown location "Europe/Nowhere"`},
+		{"testdata/config_unknown_unit.yml", "unknown unit: minutes"},
+		{"testdata/config_unknown_locale.yml", "unknown locale: fr"},
+		{"testdata/config_invalid_info_key.yml", `info key "__Build" is not a valid label name: "__Build"`},
+		{"testdata/config_duplicate_info_key.yml", `info keys "ReleaseTag" and "release_tag" have the same label name: "release_tag"`},
+		{"testdata/config_invalid_field_type.yml", `field "hits" must be a counter or a gauge, got untyped`},
+		{"testdata/config_invalid_section_label.yml", `invalid section label name: "data-source"`},
+		{"testdata/config_unknown_format.yml", "unknown format: xml"},
+		{"testdata/config_unknown_nested_keys.yml", "unknown nested_keys: labels"},
+		{"testdata/config_multiple_auth.yml", "at most one of basic_auth and bearer_token_file must be configured"},
+		{"testdata/config_missing_username.yml", "basic_auth is missing 'username'"},
+		{"testdata/config_missing_key_file.yml", "both cert_file and key_file must be configured"},
+		{"testdata/config_invalid_cidr.yml", "invalid CIDR address: 10.0.0.0/33"},
+		{"testdata/config_same_separators.yml", "decimal and grouping separators must be different"},
+		{"testdata/config_unknown_converter.yml", "unknown converter in disabled_converters: foo"},
+		{"testdata/does_not_exist.yml", "error reading config file"},
+	}
+
+	for _, test := range tests {
+		_, err := loadConfig(test.file)
+		assert.Error(err, "loading %s should fail", test.file)
+		if err != nil {
+			assert.Contains(err.Error(), test.want)
+		}
+	}
+}
+
+func TestDefaultStatusCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	var h HTTPProbe
+	assert.True(h.isValidStatusCode(200))
+	assert.False(h.isValidStatusCode(201))
+}
+
+func TestReloadConfig_keepsOldConfigOnError(t *testing.T) {
+	assert := assert.New(t)
+
+	safeConfig := &SafeConfig{C: defaultConfig()}
+
+	err := safeConfig.ReloadConfig("testdata/config_good.yml")
+	assert.NoError(err)
+	assert.Equal(float64(1), gaugeValue(configReloadSuccess))
+	assert.NotZero(gaugeValue(configReloadSeconds))
+	_, ok := safeConfig.Module("catalog")
+	assert.True(ok)
+
+	err = safeConfig.ReloadConfig("testdata/config_invalid_regexp.yml")
+	assert.Error(err)
+	assert.Equal(float64(0), gaugeValue(configReloadSuccess))
+	_, ok = safeConfig.Module("catalog")
+	assert.True(ok, "the previous config should be kept after a failed reload")
+}
+
+func gaugeValue(g prometheus.Gauge) float64 {
+	m := dto.Metric{}
+	g.Write(&m)
+	return m.GetGauge().GetValue()
+}
+
+func TestUseDefaultConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	configReloadSuccess.Set(0)
+	configReloadSeconds.Set(0)
+
+	safeConfig := &SafeConfig{}
+	safeConfig.UseDefaultConfig()
+
+	assert.Equal(float64(1), gaugeValue(configReloadSuccess))
+	assert.NotZero(gaugeValue(configReloadSeconds))
+	_, ok := safeConfig.Module(defaultModuleName)
+	assert.True(ok)
+}
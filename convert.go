@@ -2,41 +2,176 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
-type metricType int
+// Converter converts CommonStatus lines of a specific format to prometheus metrics.
+type Converter interface {
+	// Match reports whether the converter is able to convert the line.
+	Match(metric string) bool
+	// Convert sends the prometheus metrics created from the line to the channel.
+	Convert(metric string, ch chan<- prometheus.Metric) error
+}
+
+// ConverterFactory creates a converter configured with the conversion settings of a module.
+type ConverterFactory func(cfg ConversionConfig) Converter
+
+type registeredConverter struct {
+	name     string
+	priority int
+	factory  ConverterFactory
+}
+
+// converterRegistry is sorted by priority, see RegisterConverter.
+var converterRegistry []registeredConverter
 
+// Priorities of the built-in converters, the default converter is a fallback for all other lines.
 const (
-	loadAvgType metricType = iota
-	startupTimeType
-	releaseTagType
-	runningAveragesType
-	otherType
+	infoPriority            = 100
+	loadAvgPriority         = 200
+	startupTimePriority     = 300
+	runningAveragesPriority = 400
+	defaultPriority         = 1000
 )
 
+func init() {
+	RegisterConverter("info", infoPriority, func(cfg ConversionConfig) Converter {
+		return newInfoConverter(cfg.Info)
+	})
+	RegisterConverter("load_avg", loadAvgPriority, func(cfg ConversionConfig) Converter {
+		return loadAvgConverter{values: valueParser{cfg: cfg.Values}}
+	})
+	RegisterConverter("startup_time", startupTimePriority, func(cfg ConversionConfig) Converter {
+		return startupTimeConverter{cfg: cfg.StartupTime}
+	})
+	RegisterConverter("running_averages", runningAveragesPriority, func(cfg ConversionConfig) Converter {
+		return runningAveragesConverter{cfg: cfg.RunningAverages, values: valueParser{cfg: cfg.Values}}
+	})
+	RegisterConverter("default", defaultPriority, func(cfg ConversionConfig) Converter {
+		return defaultConverter{metadata: cfg.Metadata, values: valueParser{cfg: cfg.Values}}
+	})
+}
+
+// RegisterConverter adds a converter to the registry. Converters are tried in the order of their
+// priority, lower values first, and the first matching converter converts the line.
+// Converters with the same priority are tried in the order of registration.
+// It panics if a converter with the same name is already registered.
+func RegisterConverter(name string, priority int, factory ConverterFactory) {
+	if isRegisteredConverter(name) {
+		panic(fmt.Sprintf("converter %q is already registered", name))
+	}
+	converterRegistry = append(converterRegistry, registeredConverter{name: name, priority: priority, factory: factory})
+	sort.SliceStable(converterRegistry, func(i, j int) bool {
+		return converterRegistry[i].priority < converterRegistry[j].priority
+	})
+}
+
+func isRegisteredConverter(name string) bool {
+	for _, c := range converterRegistry {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newConverters creates the converters enabled by the module configuration, ordered by priority.
+func newConverters(cfg ConversionConfig) []Converter {
+	var converters []Converter
+	for _, c := range converterRegistry {
+		if cfg.isDisabled(c.name) {
+			continue
+		}
+		converters = append(converters, c.factory(cfg))
+	}
+	return converters
+}
+
+// Flusher is implemented by converters which combine several lines into metrics.
+// Flush is called after all lines of the CommonStatus page are converted.
+type Flusher interface {
+	Flush(ch chan<- prometheus.Metric) error
+}
+
+// defaultConverter is the fallback for lines with a plain numeric value,
+// the types and help of the metrics are taken from the metadata catalog.
+type defaultConverter struct {
+	metadata []MetricMetadata
+	values   valueParser
+}
+
+func (c defaultConverter) Match(metric string) bool {
+	return metricTemplate.MatchString(metric)
+}
+
+func (c defaultConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	matchResult := metricTemplate.FindStringSubmatch(metric)
+	value, err := c.values.parse(matchResult[2])
+	if err != nil {
+		return err
+	}
+
+	promMetric, err := c.createMetric(matchResult[1], value)
+	if err != nil {
+		return err
+	}
+	ch <- promMetric
+	return nil
+}
+
+func (c defaultConverter) createMetric(name string, value float64) (prometheus.Metric, error) {
+	name = invalidChars.ReplaceAllLiteralString(name, "_")
+	return metadataOf(c.metadata, name).createMetric(name, value)
+}
+
+// numberPattern matches numbers with the separators of all supported number formats, see numberFormat,
+// as well as NaN and signed infinities.
+const numberPattern = `(?:[-+]?[0-9][0-9,.'’\x{2009}\x{202F}]*(?:[eE][-+]?[0-9]+)?|[-+]?(?i:inf|infinity)|(?i:nan))`
+
 var (
-	invalidChars    = regexp.MustCompile(`[^a-zA-Z0-9:_]`)
-	loadAvg         = regexp.MustCompile(`^LoadAvg:\s+(?P<la1m>\d+(\.\d+)?) (?P<la5m>\d+(\.\d+)?) (?P<la15m>\d+(\.\d+)?)$`)
-	numbericValue   = regexp.MustCompile(`^([0-9]+[0-9,.]*[0-9]*)$`)
-	metricTemplate  = regexp.MustCompile(`^([a-zA-Z_:].*):\s+(.+)$`)
-	startupTime     = regexp.MustCompile(`^StartupTime:\s+(.*)$`)
-	releaseTag      = regexp.MustCompile(`^ReleaseTag:\s+(.*)$`)
-	runningAverages = regexp.MustCompile(`^(.+):\s+count=([0-9]+[0-9,.]*) averageValue=([0-9]+[0-9,.]*) realMaxValue=([0-9]+[0-9,.]*) averageEventRate=[0-9]+[0-9,.]* maxEventRate=[0-9]+[0-9,.]* stdDeviation=([0-9]+[0-9,.]*) maxValue=[0-9]+[0-9,.]*$`)
+	invalidChars   = regexp.MustCompile(`[^a-zA-Z0-9:_]`)
+	loadAvg        = regexp.MustCompile(`^LoadAvg:\s+(` + numberPattern + `) (` + numberPattern + `) (` + numberPattern + `)$`)
+	byteSize       = regexp.MustCompile(`^(` + numberPattern + `)\s*(?i:([KMGT]?)(?:i?B)?)$`)
+	metricTemplate = regexp.MustCompile(`^([a-zA-Z_:].*):\s+(.+)$`)
+	startupTime    = regexp.MustCompile(`^StartupTime:\s+(.*)$`)
+	methodRuntime  = regexp.MustCompile(`^(?i:MethodRuntime)_(?P<class>[^.]+)\.(?P<method>.+)$`)
+	methodByClass  = regexp.MustCompile(`^(?i:MethodRuntime_ByClass)_(?P<class>.+)$`)
 )
 
+var byteMultipliers = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseValue parses numbers in the default format, e.g. 9,220,838,392.01.
 func parseValue(value string) (float64, error) {
-	if !(numbericValue.MatchString(value)) {
-		return 0, fmt.Errorf("can't parse metric, invalid value: %s", value)
+	return defaultNumberFormat.parse(value)
+}
+
+// parseBytes parses sizes with an optional unit suffix like 1.2 GB, 512KiB or 64m.
+// Following the JVM conventions the suffixes are binary, KB and KiB are both 1024 bytes.
+func parseBytes(value string, format numberFormat) (float64, error) {
+	matchResult := byteSize.FindStringSubmatch(strings.TrimSpace(value))
+	if matchResult == nil {
+		return 0, fmt.Errorf("can't parse size, invalid value: %s", value)
 	}
 
-	value = strings.Replace(value, ",", "", -1)
-	return strconv.ParseFloat(value, 64)
+	size, err := format.parse(matchResult[1])
+	if err != nil {
+		return 0, err
+	}
+	return size * byteMultipliers[strings.ToUpper(matchResult[2])], nil
 }
 
 func createPrometheusMetricWithLabels(name string, desc string, value float64, labels prometheus.Labels, metricType prometheus.ValueType) (prometheus.Metric, error) {
@@ -46,39 +181,49 @@ func createPrometheusMetricWithLabels(name string, desc string, value float64, l
 	if err != nil {
 		return nil, err
 	}
-	return metric, nil
+	return newFamilyMetric(metric, name, desc, metricTypeOf(metricType)), nil
+}
+
+func createPrometheusSummaryWithLabels(name string, desc string, count float64, sum float64, labels prometheus.Labels) (prometheus.Metric, error) {
+	name = invalidChars.ReplaceAllLiteralString(name, "_")
+	promDesc := prometheus.NewDesc(name, desc, nil, labels)
+	summary, err := prometheus.NewConstSummary(promDesc, uint64(count), sum, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newFamilyMetric(summary, name, desc, dto.MetricType_SUMMARY), nil
 }
 
 func createPrometheusMetric(name string, desc string, value float64, metricType prometheus.ValueType) (prometheus.Metric, error) {
 	return createPrometheusMetricWithLabels(name, desc, value, nil, metricType)
 }
 
-func convertAndCreatePrometheusMetric(name string, desc string, value string, metricType prometheus.ValueType) (prometheus.Metric, error) {
-	parsedValue, err := parseValue(value)
-	if err != nil {
-		return nil, err
-	}
-	return createPrometheusMetric(name, desc, parsedValue, metricType)
+// loadAvgConverter converts the LoadAvg line to the 1m, 5m and 15m load averages.
+type loadAvgConverter struct {
+	values valueParser
 }
 
-func convertLoadAvg(metric string, ch chan<- prometheus.Metric) error {
-	if !(loadAvg.MatchString(metric)) {
-		return fmt.Errorf("no LoadAvg metric found in: %s", metric)
-	}
+func (c loadAvgConverter) Match(metric string) bool {
+	return loadAvg.MatchString(metric)
+}
 
+func (c loadAvgConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
 	matchResult := loadAvg.FindStringSubmatch(metric)
+	if matchResult == nil {
+		return fmt.Errorf("no LoadAvg metric found in: %s", metric)
+	}
 
-	la1Metric, err := convertAndCreatePrometheusMetric("load_avertage1", "1m load average.", matchResult[1], prometheus.GaugeValue)
+	la1Metric, err := c.createMetric("load_avertage1", "1m load average.", matchResult[1])
 	if err != nil {
 		return err
 	}
 
-	la5Metric, err := convertAndCreatePrometheusMetric("load_avertage5", "5m load average.", matchResult[3], prometheus.GaugeValue)
+	la5Metric, err := c.createMetric("load_avertage5", "5m load average.", matchResult[2])
 	if err != nil {
 		return err
 	}
 
-	la15Metric, err := convertAndCreatePrometheusMetric("load_avertage15", "15m load average.", matchResult[5], prometheus.GaugeValue)
+	la15Metric, err := c.createMetric("load_avertage15", "15m load average.", matchResult[3])
 	if err != nil {
 		return err
 	}
@@ -90,19 +235,46 @@ func convertLoadAvg(metric string, ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func convertStartupTime(metric string, ch chan<- prometheus.Metric) error {
+func (c loadAvgConverter) createMetric(name string, desc string, value string) (prometheus.Metric, error) {
+	parsedValue, err := c.values.number(value)
+	if err != nil {
+		return nil, err
+	}
+	return createPrometheusMetric(name, desc, parsedValue, prometheus.GaugeValue)
+}
+
+// startupTimeConverter converts the StartupTime line to the start time of the process.
+type startupTimeConverter struct {
+	cfg StartupTimeConfig
+}
+
+func (c startupTimeConverter) Match(metric string) bool {
+	return startupTime.MatchString(metric)
+}
+
+func (c startupTimeConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
 	if !(startupTime.MatchString(metric)) {
 		return fmt.Errorf("no metric with numberic value found in: %s", metric)
 	}
 
 	value := startupTime.FindStringSubmatch(metric)[1]
 
-	parsedTime, err := time.Parse(time.UnixDate, value)
+	parsedTime, err := c.parseTime(value)
 	if err != nil {
 		return err
 	}
-	uptime := time.Since(parsedTime).Seconds()
 
+	startTime, err := createPrometheusMetric("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(parsedTime.UnixNano())/1e9, prometheus.GaugeValue)
+	if err != nil {
+		return err
+	}
+	ch <- startTime
+
+	if !c.cfg.ExportUptime {
+		return nil
+	}
+
+	uptime := time.Since(parsedTime).Seconds()
 	promMetric, err := createPrometheusMetric("app_uptime_seconds_total", "Time that an application is running", uptime, prometheus.CounterValue)
 	if err != nil {
 		return err
@@ -112,15 +284,94 @@ func convertStartupTime(metric string, ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func createInfoMetric(metric string, ch chan<- prometheus.Metric) error {
-	if !releaseTag.MatchString(metric) {
-		return fmt.Errorf("the metric doesn't contain a ReleaseTag: %s", metric)
+// parseTime tries the configured layouts in order and returns the result of the first one which succeeds.
+func (c startupTimeConverter) parseTime(value string) (time.Time, error) {
+	var errs []string
+	for _, layout := range c.cfg.layouts() {
+		parsedTime, err := c.parseTimeInLocation(layout, value)
+		if err == nil {
+			return parsedTime, nil
+		}
+		errs = append(errs, err.Error())
 	}
+	return time.Time{}, fmt.Errorf("can't parse startup time %q: %s", value, strings.Join(errs, "; "))
+}
 
-	infoLabels := prometheus.Labels{
-		"release_tag": releaseTag.FindStringSubmatch(metric)[1],
+// parseTimeInLocation parses the time in the configured location. time.Parse doesn't know the offsets
+// of zone abbreviations like CET which aren't defined in the location, it fabricates a zone with zero offset
+// for them. The time is parsed again in the location configured for such an abbreviation. If there is none,
+// the wall clock of the time is interpreted in the configured location.
+func (c startupTimeConverter) parseTimeInLocation(layout string, value string) (time.Time, error) {
+	loc := c.cfg.location()
+	parsedTime, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return parsedTime, err
+	}
+
+	zone, offset := parsedTime.Zone()
+	if parsedTime.Location() == loc || offset != 0 || zone == "" || zone == "UTC" || zone == "GMT" {
+		return parsedTime, nil
+	}
+
+	if zoneLoc, ok := c.cfg.ZoneAbbreviations[zone]; ok {
+		zoneTime, err := time.ParseInLocation(layout, value, zoneLoc.Location)
+		if err != nil {
+			return zoneTime, err
+		}
+		// the tz database of the location may not know the abbreviation, e.g. MEZ for Europe/Berlin,
+		// then the wall clock of the time is interpreted in the configured location
+		if zoneTime.Location() == zoneLoc.Location {
+			return zoneTime, nil
+		}
+		return time.Date(parsedTime.Year(), parsedTime.Month(), parsedTime.Day(), parsedTime.Hour(), parsedTime.Minute(), parsedTime.Second(), parsedTime.Nanosecond(), zoneLoc.Location), nil
+	}
+
+	level.Debug(logger).Log("msg", "unknown time zone abbreviation, using the configured location", "zone", zone, "location", loc, "value", value)
+	unknownTimeZoneCount.Inc()
+	return time.Date(parsedTime.Year(), parsedTime.Month(), parsedTime.Day(), parsedTime.Hour(), parsedTime.Minute(), parsedTime.Second(), parsedTime.Nanosecond(), loc), nil
+}
+
+// infoConverter collects ReleaseTag and the configured string-valued lines into labels of commonstatus_info.
+type infoConverter struct {
+	keys   map[string]bool
+	labels prometheus.Labels
+}
+
+func newInfoConverter(cfg InfoConfig) *infoConverter {
+	keys := map[string]bool{"ReleaseTag": true}
+	for _, key := range cfg.Keys {
+		keys[key] = true
+	}
+	return &infoConverter{keys: keys, labels: prometheus.Labels{}}
+}
+
+func (c *infoConverter) Match(metric string) bool {
+	matchResult := metricTemplate.FindStringSubmatch(metric)
+	return matchResult != nil && c.keys[matchResult[1]]
+}
+
+func (c *infoConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	if !c.Match(metric) {
+		return fmt.Errorf("the metric doesn't contain an info key: %s", metric)
+	}
+
+	// commonstatus_info is a single metric without a section label, so the first value of a key is kept
+	matchResult := metricTemplate.FindStringSubmatch(metric)
+	name, value := infoLabelName(matchResult[1]), strings.TrimSpace(matchResult[2])
+	if previous, ok := c.labels[name]; ok && previous != value {
+		return fmt.Errorf("the info key %s was already found with the value %q: %s", matchResult[1], previous, metric)
+	}
+	c.labels[name] = value
+	return nil
+}
+
+// Flush sends commonstatus_info if at least one of the info lines was found.
+func (c *infoConverter) Flush(ch chan<- prometheus.Metric) error {
+	if len(c.labels) == 0 {
+		return nil
 	}
-	promMetric, err := createPrometheusMetricWithLabels("commonstatus_info", "CommonStatus information", float64(1), infoLabels, prometheus.GaugeValue)
+
+	promMetric, err := createPrometheusMetricWithLabels("commonstatus_info", "CommonStatus information", float64(1), c.labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
@@ -130,117 +381,210 @@ func createInfoMetric(metric string, ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func convertRunningAverages(metric string, ch chan<- prometheus.Metric) error {
-	if !runningAverages.MatchString(metric) {
+// releaseTag returns the ReleaseTag found by the converter.
+func (c *infoConverter) releaseTag() (string, bool) {
+	tag, ok := c.labels["release_tag"]
+	return tag, ok
+}
+
+// releaseTagOf returns the ReleaseTag found by the info converter of the collection.
+func releaseTagOf(converters []Converter) (string, bool) {
+	for _, converter := range converters {
+		if info, ok := converter.(*infoConverter); ok {
+			return info.releaseTag()
+		}
+	}
+	return "", false
+}
+
+// infoLabelName sanitizes the key like the metric names, colons aren't allowed in label names.
+func infoLabelName(key string) string {
+	if key == "ReleaseTag" {
+		return "release_tag"
+	}
+	return strings.Replace(invalidChars.ReplaceAllLiteralString(key, "_"), ":", "_", -1)
+}
+
+// runningAveragesFields are the fields of RunningAverages lines, other fields are ignored.
+var runningAveragesFields = []string{"count", "averageValue", "realMaxValue", "averageEventRate", "maxEventRate", "stdDeviation", "maxValue"}
+
+// runningAveragesDurations are the fields of RunningAverages lines in the unit of the line, they can't be negative.
+var runningAveragesDurations = []string{"averageValue", "realMaxValue", "stdDeviation", "maxValue"}
+
+// runningAveragesConverter converts RunningAverages lines: "Name: count=... averageValue=... realMaxValue=...".
+// The order of the fields doesn't matter.
+type runningAveragesConverter struct {
+	cfg    RunningAveragesConfig
+	values valueParser
+}
+
+func (c runningAveragesConverter) Match(metric string) bool {
+	_, _, ok := runningAveragesOf(metric)
+	return ok
+}
+
+// runningAveragesOf returns the name and the fields of a RunningAverages line.
+func runningAveragesOf(metric string) (string, map[string]string, bool) {
+	name, fields, ok := parseFields(metric)
+	if !ok {
+		return "", nil, false
+	}
+	for _, field := range runningAveragesFields {
+		if _, ok := fields[field]; !ok {
+			return "", nil, false
+		}
+	}
+	return name, fields, true
+}
+
+// nameAndLabels returns the base name of the metrics, MethodRuntime names are split into labels if configured.
+func (c runningAveragesConverter) nameAndLabels(name string) (string, prometheus.Labels) {
+	if !c.cfg.SplitMethodNames {
+		return name, nil
+	}
+	// MethodRunTime_ByClass_ has to be checked first, it matches the MethodRuntime_ pattern if the class contains a dot
+	if m := methodByClass.FindStringSubmatch(name); m != nil {
+		return "method_runtime_by_class", prometheus.Labels{"class": m[1]}
+	}
+	if m := methodRuntime.FindStringSubmatch(name); m != nil {
+		return "method_runtime", prometheus.Labels{"class": m[1], "method": m[2]}
+	}
+	return name, nil
+}
+
+func (c runningAveragesConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	name, fields, ok := runningAveragesOf(metric)
+	if !ok {
 		return fmt.Errorf("the metric doesn't contain a RunningAverages: %s", metric)
 	}
 
 	/*
-		TimeSearch:
+		TimeSearch (the values are in milliseconds by default, see RunningAveragesConfig.Unit):
 		count=77 -> creating Prometheus metric TimeSearch_total
 		averageValue=275 -> creating Prometheus metric TimeSearch_seconds_total: count*averageValue/1000
+		  (or summary TimeSearch_seconds with _count=count and _sum=count*averageValue/1000 if configured)
 		realMaxValue=2,784 -> creating Prometheus metric TimeSearch_max_seconds: realMaxValue/1000
 		averageEventRate=1.283 -> dropping, use Prometheus rate() instead
+		  (or creating Prometheus metric TimeSearch_average_event_rate if configured)
 		maxEventRate=3 -> dropping, use Prometheus rate() instead + max_over_time()
+		  (or creating Prometheus metric TimeSearch_max_event_rate if configured)
 		stdDeviation=409 -> creating Prometheus metric TimeSearch_stddev_seconds: stdDeviation/1000
 		maxValue=684 (-)  -> dropping, use avg + stddev instead
+		  (or creating Prometheus metric TimeSearch_recent_max_seconds: maxValue/1000 if configured)
 	*/
-	matchResult := runningAverages.FindStringSubmatch(metric)
-
-	metricName := matchResult[1]
-	count, err := parseValue(matchResult[2])
-	if err != nil {
-		return err
+	metricName, labels := c.nameAndLabels(name)
+	values := map[string]float64{}
+	for _, field := range runningAveragesFields {
+		value, err := c.values.number(fields[field])
+		if err != nil {
+			return err
+		}
+		values[field] = value
 	}
-	averageValue, err := parseValue(matchResult[3])
-	if err != nil {
-		return err
+	count, averageValue, realMaxValue, stdDeviation := values["count"], values["averageValue"], values["realMaxValue"], values["stdDeviation"]
+	if count < 0 || math.IsNaN(count) || math.IsInf(count, 0) {
+		return fmt.Errorf("invalid count of %s: %s", name, fields["count"])
 	}
-	realMaxValue, err := parseValue(matchResult[4])
-	if err != nil {
-		return err
+	for _, field := range runningAveragesDurations {
+		if values[field] < 0 {
+			return fmt.Errorf("negative %s of %s: %s", field, name, fields[field])
+		}
+	}
+
+	unit := c.cfg.unitOf(name)
+	divisor, suffix, quantity := unit.divisor(), unit.suffix(), unit.quantity()
+
+	if c.cfg.Summary {
+		// the quantities are lower case ASCII words, only the first letter is capitalized
+		help := strings.ToUpper(quantity[:1]) + quantity[1:] + " of " + metricName + " requests"
+		summary, err := createPrometheusSummaryWithLabels(metricName+suffix, help, count, count*averageValue/divisor, labels)
+		if err != nil {
+			return err
+		}
+		ch <- summary
+	} else {
+		total, err := createPrometheusMetricWithLabels(metricName+"_total", "Total number of "+metricName+" requests", count, labels, prometheus.CounterValue)
+		if err != nil {
+			return err
+		}
+
+		sumTotal, err := createPrometheusMetricWithLabels(metricName+suffix+"_total", "Total "+quantity+" of "+metricName+" requests", count*averageValue/divisor, labels, prometheus.CounterValue)
+		if err != nil {
+			return err
+		}
+
+		ch <- total
+		ch <- sumTotal
 	}
-	stdDeviation, err := parseValue(matchResult[5])
+
+	maxValue, err := createPrometheusMetricWithLabels(metricName+"_max"+suffix, "Maximal "+quantity+" of "+metricName+" request", realMaxValue/divisor, labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
 
-	total, err := createPrometheusMetric(metricName+"_total", "Total number of "+metricName+" requests", count, prometheus.CounterValue)
+	stddevValue, err := createPrometheusMetricWithLabels(metricName+"_stddev"+suffix, "Standart deviation of "+metricName+" "+quantity, stdDeviation/divisor, labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
 
-	secondsTotal, err := createPrometheusMetric(metricName+"_seconds_total", "Total duration of "+metricName+" requests", count*averageValue/1000, prometheus.CounterValue)
+	ch <- maxValue
+	ch <- stddevValue
+
+	if !c.cfg.KeepAllFields {
+		return nil
+	}
+
+	averageEventRate, err := createPrometheusMetricWithLabels(metricName+"_average_event_rate", "Average event rate of "+metricName+" requests", values["averageEventRate"], labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
 
-	maxSeconds, err := createPrometheusMetric(metricName+"_max_seconds", "Maximal duration of "+metricName+" request", realMaxValue/1000, prometheus.GaugeValue)
+	maxEventRate, err := createPrometheusMetricWithLabels(metricName+"_max_event_rate", "Maximal event rate of "+metricName+" requests", values["maxEventRate"], labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
 
-	stddevSeconds, err := createPrometheusMetric(metricName+"_stddev_seconds", "Standart deviation of "+metricName+" duration", stdDeviation/1000, prometheus.GaugeValue)
+	recentMax, err := createPrometheusMetricWithLabels(metricName+"_recent_max"+suffix, "Maximal "+quantity+" of recent "+metricName+" requests", values["maxValue"]/divisor, labels, prometheus.GaugeValue)
 	if err != nil {
 		return err
 	}
 
-	ch <- total
-	ch <- secondsTotal
-	ch <- maxSeconds
-	ch <- stddevSeconds
+	ch <- averageEventRate
+	ch <- maxEventRate
+	ch <- recentMax
 
 	return nil
 }
 
-func defaultMetricsConverter(metric string, ch chan<- prometheus.Metric) error {
-	matchResult := metricTemplate.FindStringSubmatch(metric)
-	name := matchResult[1]
-	value := matchResult[2]
-
-	promMetric, err := convertAndCreatePrometheusMetric(name, "", value, prometheus.UntypedValue)
-	if err != nil {
-		return err
+// namedGroups maps the names of the groups of the expression to the matched values.
+func namedGroups(re *regexp.Regexp, match []string) map[string]string {
+	groups := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if name != "" && i < len(match) {
+			groups[name] = match[i]
+		}
 	}
-	ch <- promMetric
-	return nil
+	return groups
 }
 
-func getMetricType(metric string) metricType {
-	if releaseTag.MatchString(metric) {
-		return releaseTagType
+// defaultConversion returns the default converter if the line is handled by it only.
+func defaultConversion(metric string, converters []Converter) (defaultConverter, bool) {
+	for _, c := range converters {
+		if c.Match(metric) {
+			dc, ok := c.(defaultConverter)
+			return dc, ok
+		}
 	}
-
-	if loadAvg.MatchString(metric) {
-		return loadAvgType
-	}
-
-	if startupTime.MatchString(metric) {
-		return startupTimeType
-	}
-
-	if runningAverages.MatchString(metric) {
-		return runningAveragesType
-	}
-
-	return otherType
+	return defaultConverter{}, false
 }
 
-func convertMetric(metric string, ch chan<- prometheus.Metric) error {
-	if !metricTemplate.MatchString(metric) {
-		return fmt.Errorf("the string doesn't contain a valid metric: %s", metric)
-	}
-
-	switch getMetricType(metric) {
-	case releaseTagType:
-		return createInfoMetric(metric, ch)
-	case loadAvgType:
-		return convertLoadAvg(metric, ch)
-	case startupTimeType:
-		return convertStartupTime(metric, ch)
-	case runningAveragesType:
-		return convertRunningAverages(metric, ch)
-	default:
-		return defaultMetricsConverter(metric, ch)
+// convertMetric converts the line with the first matching converter. The converters check the format of
+// the line themselves, conversion rules can match lines which aren't in the "Name: value" form.
+func convertMetric(metric string, converters []Converter, ch chan<- prometheus.Metric) error {
+	for _, c := range converters {
+		if c.Match(metric) {
+			return c.Convert(metric, ch)
+		}
 	}
+	return fmt.Errorf("no converter found for the metric: %s", metric)
 }
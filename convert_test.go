@@ -2,6 +2,7 @@ package main
 
 import (
 	"io/ioutil"
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -30,7 +31,7 @@ func TestConvertLoadAvg_ok(t *testing.T) {
 	ch := make(chan prometheus.Metric, 3)
 	defer close(ch)
 
-	err := convertLoadAvg(input, ch)
+	err := loadAvgConverter{}.Convert(input, ch)
 
 	assert.NoError(err)
 	if err != nil {
@@ -56,9 +57,31 @@ func TestConvertLoadAvg_invalidInput(t *testing.T) {
 	ch := make(chan prometheus.Metric)
 	defer close(ch)
 
-	err := convertLoadAvg(invalidInput, ch)
+	err := loadAvgConverter{}.Convert(invalidInput, ch)
 
-	assert.NotNilf(err, "convertLoadAvg should return error for invalid input")
+	assert.NotNilf(err, "the load_avg converter should return error for invalid input")
+}
+
+func TestConvertLoadAvg_locale(t *testing.T) {
+	assert := assert.New(t)
+
+	c := loadAvgConverter{values: valueParser{cfg: ValuesConfig{Locale: "de"}}}
+	input := "LoadAvg: 1,94 3,44 5,07"
+
+	ch := make(chan prometheus.Metric, 3)
+	defer close(ch)
+
+	assert.True(c.Match(input))
+	err := c.Convert(input, ch)
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, want := range []float64{1.94, 3.44, 5.07} {
+		m := dto.Metric{}
+		(<-ch).Write(&m)
+		assert.Equal(want, m.GetGauge().GetValue())
+	}
 }
 
 func TestParseValue(t *testing.T) {
@@ -77,6 +100,18 @@ func TestParseValue(t *testing.T) {
 		{"55", 55},
 		{"0", 0},
 		{"2,784", 2784},
+		{"-5", -5},
+		{"+5", 5},
+		{"-1,234.5", -1234.5},
+		{"-0.25", -0.25},
+		{"1.2e-3", 0.0012},
+		{"1.2E3", 1200},
+		{"-2.5e+2", -250},
+		{"1,234e2", 123400},
+		{"+Inf", math.Inf(1)},
+		{"Inf", math.Inf(1)},
+		{"-Inf", math.Inf(-1)},
+		{"-infinity", math.Inf(-1)},
 	}
 
 	for _, test := range tests {
@@ -88,6 +123,56 @@ func TestParseValue(t *testing.T) {
 
 		assert.Equal(test.want, result)
 	}
+
+	for _, value := range []string{"NaN", "nan"} {
+		result, err := parseValue(value)
+		assert.NoError(err)
+		assert.True(math.IsNaN(result), "value: %s", value)
+	}
+}
+
+func TestParseValue_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, value := range []string{"", "-", "+-5", "--5", "5-", "1.2e", "1.2e-", "e5", "1e2.5", "0x1F", "1_000", "NaNa", "Inf5", "- 5"} {
+		_, err := parseValue(value)
+		assert.Error(err, "value: %s", value)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := assert.New(t)
+	type testpair struct {
+		value string
+		want  float64
+	}
+
+	var tests = []testpair{
+		{"9,220,838,392", 9220838392},
+		{"512B", 512},
+		{"64k", 64 * 1024},
+		{"1.5 KB", 1536},
+		{"512KiB", 512 * 1024},
+		{"2 MB", 2 * 1024 * 1024},
+		{"1.2 GB", 1.2 * 1024 * 1024 * 1024},
+		{"4GiB", 4 * 1024 * 1024 * 1024},
+		{"1 TB", 1024 * 1024 * 1024 * 1024},
+	}
+
+	for _, test := range tests {
+		result, err := parseBytes(test.value, defaultNumberFormat)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		assert.Equal(test.want, result, "value: %s", test.value)
+	}
+
+	for _, value := range []string{"", "GB", "1.2 PB", "12 bytes"} {
+		_, err := parseBytes(value, defaultNumberFormat)
+		assert.Error(err, "value: %s", value)
+	}
 }
 
 func TestConvertStartupTime_ok(t *testing.T) {
@@ -104,20 +189,26 @@ func TestConvertStartupTime_ok(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		ch := make(chan prometheus.Metric, 1)
+		ch := make(chan prometheus.Metric, 2)
 		defer close(ch)
 
-		err := convertStartupTime(test.metric, ch)
+		err := startupTimeConverter{cfg: StartupTimeConfig{ExportUptime: true}}.Convert(test.metric, ch)
 		assert.NoError(err)
 		if err != nil {
 			return
 		}
 
+		parsedTime, _ := time.Parse(time.UnixDate, test.timeString)
+		compareMetrics(t, prometheus.MustNewConstMetric(
+			prometheus.NewDesc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", nil, nil),
+			prometheus.GaugeValue,
+			float64(parsedTime.Unix()),
+		), <-ch)
+
 		result := <-ch
 		resultDesc := result.Desc().String()
 
 		wantDesc := prometheus.NewDesc("app_uptime_seconds_total", "Time that an application is running", nil, nil)
-		parsedTime, _ := time.Parse(time.UnixDate, test.timeString)
 		uptime := time.Since(parsedTime).Seconds()
 		want := prometheus.MustNewConstMetric(wantDesc, prometheus.CounterValue, uptime)
 		assert.Equal(wantDesc.String(), resultDesc, "descriptions are different! Wanted: %v, got: %v, metric: %s", wantDesc, resultDesc, test.metric)
@@ -131,6 +222,43 @@ func TestConvertStartupTime_ok(t *testing.T) {
 	}
 }
 
+func TestConvertStartupTime_layouts(t *testing.T) {
+	assert := assert.New(t)
+
+	c := startupTimeConverter{cfg: StartupTimeConfig{Layouts: []string{time.UnixDate, time.RFC3339, "2006-01-02 15:04:05"}}}
+
+	type testpair struct {
+		metric string
+		want   float64
+	}
+
+	var tests = []testpair{
+		{"StartupTime: Mon Jan 28 14:24:03 UTC 2019", 1548685443},
+		{"StartupTime: 2019-01-28T14:24:03+01:00", 1548681843},
+		{"StartupTime: 2019-01-28 14:24:03", 1548685443},
+	}
+
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 1)
+		defer close(ch)
+
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		compareMetrics(t, prometheus.MustNewConstMetric(
+			prometheus.NewDesc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", nil, nil),
+			prometheus.GaugeValue,
+			test.want,
+		), <-ch)
+	}
+
+	err := c.Convert("StartupTime: yesterday", make(chan prometheus.Metric, 1))
+	assert.Error(err)
+}
+
 func TestCreateInfoMetric_ok(t *testing.T) {
 	assert := assert.New(t)
 
@@ -149,7 +277,14 @@ func TestCreateInfoMetric_ok(t *testing.T) {
 		ch := make(chan prometheus.Metric, 1)
 		defer close(ch)
 
-		createInfoMetric(test.metric, ch)
+		c := newInfoConverter(InfoConfig{})
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		err = c.Flush(ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
 
 		result := <-ch
 		resultMetric := dto.Metric{}
@@ -165,6 +300,59 @@ func TestCreateInfoMetric_ok(t *testing.T) {
 	}
 }
 
+func TestCreateInfoMetric_keys(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newInfoConverter(InfoConfig{Keys: []string{"Hostname", "Java.Version", "BuildId"}})
+	lines := []string{
+		"ReleaseTag: 0.0.32",
+		"Hostname: catalog-01.example.com",
+		"Java.Version: 1.8.0_202",
+		"BuildId: 4711",
+	}
+
+	ch := make(chan prometheus.Metric, 1)
+	defer close(ch)
+
+	for _, line := range lines {
+		assert.True(c.Match(line), "info converter should match: %s", line)
+		assert.NoError(c.Convert(line, ch))
+	}
+	assert.False(c.Match("ThreadCount: 3009"))
+	assert.Len(ch, 0, "info metric should be sent on flush only")
+
+	err := c.Flush(ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	want := prometheus.MustNewConstMetric(
+		prometheus.NewDesc("commonstatus_info", "CommonStatus information", nil, prometheus.Labels{
+			"release_tag":  "0.0.32",
+			"Hostname":     "catalog-01.example.com",
+			"Java_Version": "1.8.0_202",
+			"BuildId":      "4711",
+		}),
+		prometheus.GaugeValue,
+		1,
+	)
+	compareMetrics(t, want, <-ch)
+
+	assert.NoError(newInfoConverter(InfoConfig{}).Flush(ch))
+	assert.Len(ch, 0, "info metric should not be sent without info lines")
+}
+
+func TestCreateInfoMetric_repeatedKey(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newInfoConverter(InfoConfig{Keys: []string{"Hostname"}})
+	assert.NoError(c.Convert("Hostname: catalog-01", nil))
+	assert.NoError(c.Convert("Hostname: catalog-01", nil), "the same value may be repeated")
+	assert.Error(c.Convert("Hostname: catalog-02", nil), "a different value should not overwrite the first one")
+	assert.Equal(prometheus.Labels{"Hostname": "catalog-01"}, c.labels)
+}
+
 func TestRunningAveragesParser_ok(t *testing.T) {
 	assert := assert.New(t)
 
@@ -230,7 +418,7 @@ func TestRunningAveragesParser_ok(t *testing.T) {
 		ch := make(chan prometheus.Metric, 4)
 		defer close(ch)
 
-		err := convertRunningAverages(test.metric, ch)
+		err := runningAveragesConverter{}.Convert(test.metric, ch)
 		assert.NoError(err)
 		if err != nil {
 			return
@@ -247,6 +435,31 @@ func TestRunningAveragesParser_ok(t *testing.T) {
 	}
 }
 
+func TestRunningAveragesParser_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []string{
+		"TimeSearch: count=-77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+		"TimeSearch: count=NaN averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+		"TimeSearch: count=+Inf averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+		"TimeSearch: count=77 averageValue=-275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+		"TimeSearch: count=77 averageValue=275 realMaxValue=-2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+		"TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=-409 maxValue=684",
+		"TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=-684",
+	}
+
+	ch := make(chan prometheus.Metric, 7)
+	defer close(ch)
+
+	for _, cfg := range []RunningAveragesConfig{{}, {Summary: true}} {
+		for _, metric := range tests {
+			err := runningAveragesConverter{cfg: cfg}.Convert(metric, ch)
+			assert.Error(err, "metric: %s, summary: %t", metric, cfg.Summary)
+		}
+	}
+	assert.Len(ch, 0, "no metrics should be sent for invalid lines")
+}
+
 func compareMetrics(t *testing.T, want prometheus.Metric, result prometheus.Metric) {
 	assert := assert.New(t)
 	wantDesc := want.Desc().String()
@@ -272,26 +485,50 @@ func TestDefaultMetricsConverter(t *testing.T) {
 		{
 			"MemoryUsed: 9,220,838,392",
 			prometheus.MustNewConstMetric(
-				prometheus.NewDesc("MemoryUsed", "", nil, nil),
-				prometheus.UntypedValue,
+				prometheus.NewDesc("MemoryUsed", "Used memory of the JVM in bytes", nil, nil),
+				prometheus.GaugeValue,
 				float64(9220838392),
 			),
 		},
 		{
 			"GC-PS-MarkSweep_AvgInterval: 2906504",
 			prometheus.MustNewConstMetric(
-				prometheus.NewDesc("GC_PS_MarkSweep_AvgInterval", "", nil, nil),
-				prometheus.UntypedValue,
+				prometheus.NewDesc("GC_PS_MarkSweep_AvgInterval", "Average interval between collections of the garbage collector in milliseconds", nil, nil),
+				prometheus.GaugeValue,
 				float64(2906504),
 			),
 		},
+		{
+			"GC_PS_Scavenge_Count: 5,050",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("GC_PS_Scavenge_Count", "Number of collections of the garbage collector", nil, nil),
+				prometheus.CounterValue,
+				float64(5050),
+			),
+		},
+		{
+			"Requests_Count: 12",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("Requests_Count", "", nil, nil),
+				prometheus.CounterValue,
+				float64(12),
+			),
+		},
+		{
+			"DuplicatesSetCount: 21822857",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("DuplicatesSetCount", "", nil, nil),
+				prometheus.GaugeValue,
+				float64(21822857),
+			),
+		},
 	}
 
 	for _, test := range tests {
 		ch := make(chan prometheus.Metric, 1)
 		defer close(ch)
 
-		err := defaultMetricsConverter(test.metric, ch)
+		err := defaultConverter{}.Convert(test.metric, ch)
 		assert.NoError(err)
 		if err != nil {
 			return
@@ -306,13 +543,493 @@ func TestConvertMetric_ok(t *testing.T) {
 	assert := assert.New(t)
 
 	validMetrics, _ := ioutil.ReadFile("docker/testservice/valid_metrics.txt")
+	converters := newConverters(ConversionConfig{})
 
 	for _, metric := range strings.Split(string(validMetrics), "\n") {
 		ch := make(chan prometheus.Metric, 99)
 		defer close(ch)
 		if len(metric) > 0 {
-			err := convertMetric(metric, ch)
+			err := convertMetric(metric, converters, ch)
 			assert.NoError(err)
 		}
 	}
 }
+
+type testConverter struct {
+	prefix string
+	name   string
+}
+
+func (c testConverter) Match(metric string) bool {
+	return strings.HasPrefix(metric, c.prefix)
+}
+
+func (c testConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	promMetric, err := createPrometheusMetric(c.name, "", 1, prometheus.GaugeValue)
+	if err != nil {
+		return err
+	}
+	ch <- promMetric
+	return nil
+}
+
+func TestRegisterConverter_priority(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(r []registeredConverter) { converterRegistry = r }(append([]registeredConverter(nil), converterRegistry...))
+
+	RegisterConverter("test_late", defaultPriority-1, func(ConversionConfig) Converter {
+		return testConverter{prefix: "Custom", name: "late"}
+	})
+	RegisterConverter("test_early", infoPriority-1, func(ConversionConfig) Converter {
+		return testConverter{prefix: "Custom", name: "early"}
+	})
+	assert.Panics(func() {
+		RegisterConverter("test_early", 0, nil)
+	})
+
+	ch := make(chan prometheus.Metric, 1)
+	defer close(ch)
+
+	err := convertMetric("CustomLine: foo", newConverters(ConversionConfig{}), ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("early", "", nil, nil), prometheus.GaugeValue, 1), <-ch)
+
+	err = convertMetric("CustomLine: foo", newConverters(ConversionConfig{DisabledConverters: []string{"test_early"}}), ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("late", "", nil, nil), prometheus.GaugeValue, 1), <-ch)
+}
+
+func TestConvertMetric_disabledConverter(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 4)
+	defer close(ch)
+
+	converters := newConverters(ConversionConfig{DisabledConverters: []string{"load_avg", "default"}})
+	err := convertMetric("LoadAvg: 1.94 3.44 5.07", converters, ch)
+	assert.Error(err)
+}
+
+func TestRunningAveragesParser_splitMethodNames(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		metric string
+		want   []prometheus.Metric
+	}
+
+	methodLabels := prometheus.Labels{"class": "CatalogDuplicatesService", "method": "getDuplicateSets"}
+	classLabels := prometheus.Labels{"class": "CatalogDuplicatesService"}
+
+	tests := []testpair{
+		{
+			"MethodRuntime_CatalogDuplicatesService.getDuplicateSets: count=2,597 averageValue=1 realMaxValue=1,067 averageEventRate=43.283 maxEventRate=74 stdDeviation=23 maxValue=24",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_total", "Total number of method_runtime requests", nil, methodLabels),
+					prometheus.CounterValue,
+					2597,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_seconds_total", "Total duration of method_runtime requests", nil, methodLabels),
+					prometheus.CounterValue,
+					float64(2597.0*1.0/1000.0),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_max_seconds", "Maximal duration of method_runtime request", nil, methodLabels),
+					prometheus.GaugeValue,
+					float64(1067.0/1000.0),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_stddev_seconds", "Standart deviation of method_runtime duration", nil, methodLabels),
+					prometheus.GaugeValue,
+					float64(23.0/1000.0),
+				),
+			},
+		},
+		{
+			"MethodRunTime_ByClass_CatalogDuplicatesService: count=2,597 averageValue=1 realMaxValue=1,067 averageEventRate=43.283 maxEventRate=74 stdDeviation=23 maxValue=24",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_by_class_total", "Total number of method_runtime_by_class requests", nil, classLabels),
+					prometheus.CounterValue,
+					2597,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_by_class_seconds_total", "Total duration of method_runtime_by_class requests", nil, classLabels),
+					prometheus.CounterValue,
+					float64(2597.0*1.0/1000.0),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_by_class_max_seconds", "Maximal duration of method_runtime_by_class request", nil, classLabels),
+					prometheus.GaugeValue,
+					float64(1067.0/1000.0),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("method_runtime_by_class_stddev_seconds", "Standart deviation of method_runtime_by_class duration", nil, classLabels),
+					prometheus.GaugeValue,
+					float64(23.0/1000.0),
+				),
+			},
+		},
+		{
+			"TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("TimeSearch_total", "Total number of TimeSearch requests", nil, nil),
+					prometheus.CounterValue,
+					77,
+				),
+			},
+		},
+	}
+
+	c := runningAveragesConverter{cfg: RunningAveragesConfig{SplitMethodNames: true}}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 4)
+		defer close(ch)
+
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		var results []prometheus.Metric
+		for i := 0; i < len(test.want); i++ {
+			results = append(results, <-ch)
+		}
+
+		for i, want := range test.want {
+			compareMetrics(t, want, results[i])
+		}
+	}
+}
+
+func TestRunningAveragesParser_summary(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684"
+
+	wants := []prometheus.Metric{
+		prometheus.MustNewConstSummary(
+			prometheus.NewDesc("TimeSearch_seconds", "Duration of TimeSearch requests", nil, nil),
+			77,
+			float64(275.0/1000.0*77.0),
+			nil,
+		),
+		prometheus.MustNewConstMetric(
+			prometheus.NewDesc("TimeSearch_max_seconds", "Maximal duration of TimeSearch request", nil, nil),
+			prometheus.GaugeValue,
+			float64(2784.0/1000.0),
+		),
+		prometheus.MustNewConstMetric(
+			prometheus.NewDesc("TimeSearch_stddev_seconds", "Standart deviation of TimeSearch duration", nil, nil),
+			prometheus.GaugeValue,
+			float64(409.0/1000.0),
+		),
+	}
+
+	ch := make(chan prometheus.Metric, 3)
+	defer close(ch)
+
+	err := runningAveragesConverter{cfg: RunningAveragesConfig{Summary: true}}.Convert(input, ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	for _, want := range wants {
+		compareMetrics(t, want, <-ch)
+	}
+}
+
+func TestRunningAveragesParser_units(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		metric string
+		want   []prometheus.Metric
+	}
+
+	tests := []testpair{
+		{
+			"ResponseSize: count=4 averageValue=512 realMaxValue=2,048 averageEventRate=0.1 maxEventRate=1 stdDeviation=100 maxValue=1,024",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResponseSize_total", "Total number of ResponseSize requests", nil, nil),
+					prometheus.CounterValue,
+					4,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResponseSize_bytes_total", "Total size of ResponseSize requests", nil, nil),
+					prometheus.CounterValue,
+					2048,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResponseSize_max_bytes", "Maximal size of ResponseSize request", nil, nil),
+					prometheus.GaugeValue,
+					2048,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResponseSize_stddev_bytes", "Standart deviation of ResponseSize size", nil, nil),
+					prometheus.GaugeValue,
+					100,
+				),
+			},
+		},
+		{
+			"ResultCount: count=2 averageValue=10 realMaxValue=15 averageEventRate=0.1 maxEventRate=1 stdDeviation=5 maxValue=15",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResultCount_total", "Total number of ResultCount requests", nil, nil),
+					prometheus.CounterValue,
+					2,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResultCount_value_total", "Total value of ResultCount requests", nil, nil),
+					prometheus.CounterValue,
+					20,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResultCount_max_value", "Maximal value of ResultCount request", nil, nil),
+					prometheus.GaugeValue,
+					15,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("ResultCount_stddev_value", "Standart deviation of ResultCount value", nil, nil),
+					prometheus.GaugeValue,
+					5,
+				),
+			},
+		},
+		{
+			"TimeSearch: count=2 averageValue=1,500 realMaxValue=2,000 averageEventRate=0.1 maxEventRate=1 stdDeviation=500 maxValue=2,000",
+			[]prometheus.Metric{
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("TimeSearch_total", "Total number of TimeSearch requests", nil, nil),
+					prometheus.CounterValue,
+					2,
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("TimeSearch_seconds_total", "Total duration of TimeSearch requests", nil, nil),
+					prometheus.CounterValue,
+					float64(2.0*1500.0/1e6),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("TimeSearch_max_seconds", "Maximal duration of TimeSearch request", nil, nil),
+					prometheus.GaugeValue,
+					float64(2000.0/1e6),
+				),
+				prometheus.MustNewConstMetric(
+					prometheus.NewDesc("TimeSearch_stddev_seconds", "Standart deviation of TimeSearch duration", nil, nil),
+					prometheus.GaugeValue,
+					float64(500.0/1e6),
+				),
+			},
+		},
+	}
+
+	c := runningAveragesConverter{cfg: RunningAveragesConfig{
+		Unit: MicrosecondsUnit,
+		Units: []UnitPrefix{
+			{Prefix: "ResponseSize", Unit: BytesUnit},
+			{Prefix: "Result", Unit: NoneUnit},
+		},
+	}}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 4)
+		defer close(ch)
+
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		for _, want := range test.want {
+			compareMetrics(t, want, <-ch)
+		}
+	}
+}
+
+func TestRunningAveragesParser_keepAllFields(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684"
+
+	wants := []prometheus.Metric{
+		prometheus.MustNewConstMetric(
+			prometheus.NewDesc("TimeSearch_average_event_rate", "Average event rate of TimeSearch requests", nil, nil),
+			prometheus.GaugeValue,
+			1.283,
+		),
+		prometheus.MustNewConstMetric(
+			prometheus.NewDesc("TimeSearch_max_event_rate", "Maximal event rate of TimeSearch requests", nil, nil),
+			prometheus.GaugeValue,
+			3,
+		),
+		prometheus.MustNewConstMetric(
+			prometheus.NewDesc("TimeSearch_recent_max_seconds", "Maximal duration of recent TimeSearch requests", nil, nil),
+			prometheus.GaugeValue,
+			float64(684.0/1000.0),
+		),
+	}
+
+	ch := make(chan prometheus.Metric, 7)
+	defer close(ch)
+
+	err := runningAveragesConverter{cfg: RunningAveragesConfig{KeepAllFields: true}}.Convert(input, ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	// skip the total, seconds_total, max_seconds and stddev_seconds metrics
+	for i := 0; i < 4; i++ {
+		<-ch
+	}
+	for _, want := range wants {
+		compareMetrics(t, want, <-ch)
+	}
+}
+
+func TestRunningAveragesParser_fieldOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	c := runningAveragesConverter{}
+	want := "TimeSearch: count=77 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684"
+
+	for _, input := range []string{
+		"TimeSearch: maxValue=684 stdDeviation=409 maxEventRate=3 averageEventRate=1.283 realMaxValue=2,784 averageValue=275 count=77",
+		"TimeSearch: count=77 minValue=3 averageValue=275 realMaxValue=2,784 averageEventRate=1.283 maxEventRate=3 stdDeviation=409 maxValue=684 p99=1,200",
+	} {
+		assert.True(c.Match(input), "input: %s", input)
+
+		wantCh, gotCh := make(chan prometheus.Metric, 4), make(chan prometheus.Metric, 4)
+		assert.NoError(c.Convert(want, wantCh))
+		assert.NoError(c.Convert(input, gotCh))
+		close(wantCh)
+		close(gotCh)
+		for m := range wantCh {
+			compareMetrics(t, m, <-gotCh)
+		}
+	}
+
+	assert.False(c.Match("TimeSearch: count=77 averageValue=275 realMaxValue=2,784"), "all fields are required")
+}
+
+func TestConvertStartupTime_zones(t *testing.T) {
+	assert := assert.New(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	type testpair struct {
+		cfg         StartupTimeConfig
+		metric      string
+		want        time.Time
+		unknownZone bool
+	}
+
+	var tests = []testpair{
+		{
+			StartupTimeConfig{ZoneAbbreviations: map[string]Location{"CET": {berlin}, "CEST": {berlin}}},
+			"StartupTime: Mon Jan 28 14:24:03 CET 2019",
+			time.Date(2019, 1, 28, 13, 24, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{ZoneAbbreviations: map[string]Location{"CET": {berlin}, "CEST": {berlin}}},
+			"StartupTime: Mon Jul 01 14:24:03 CEST 2019",
+			time.Date(2019, 7, 1, 12, 24, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{ZoneAbbreviations: map[string]Location{"MEZ": {berlin}}},
+			"StartupTime: Mon Jan 28 14:24:03 MEZ 2019",
+			time.Date(2019, 1, 28, 13, 24, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{ZoneAbbreviations: map[string]Location{"IST": {kolkata}}},
+			"StartupTime: Mon Jan 28 14:24:03 IST 2019",
+			time.Date(2019, 1, 28, 8, 54, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{Location: Location{berlin}},
+			"StartupTime: Mon Jan 28 14:24:03 CET 2019",
+			time.Date(2019, 1, 28, 13, 24, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{Location: Location{newYork}},
+			"StartupTime: Mon Jan 28 14:24:03 GMT 2019",
+			time.Date(2019, 1, 28, 14, 24, 3, 0, time.UTC),
+			false,
+		},
+		{
+			StartupTimeConfig{Location: Location{berlin}},
+			"StartupTime: Mon Jan 28 14:24:03 XYZ 2019",
+			time.Date(2019, 1, 28, 13, 24, 3, 0, time.UTC),
+			true,
+		},
+		{
+			StartupTimeConfig{},
+			"StartupTime: Mon Jan 28 14:24:03 CET 2019",
+			time.Date(2019, 1, 28, 14, 24, 3, 0, time.UTC),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 1)
+		defer close(ch)
+
+		before := counterValue(unknownTimeZoneCount)
+		err := startupTimeConverter{cfg: test.cfg}.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		compareMetrics(t, prometheus.MustNewConstMetric(
+			prometheus.NewDesc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", nil, nil),
+			prometheus.GaugeValue,
+			float64(test.want.Unix()),
+		), <-ch)
+
+		if test.unknownZone {
+			assert.Equal(before+1, counterValue(unknownTimeZoneCount), "unknown zone should be counted: %s", test.metric)
+		} else {
+			assert.Equal(before, counterValue(unknownTimeZoneCount), "zone should be known: %s", test.metric)
+		}
+	}
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	m := dto.Metric{}
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
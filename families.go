@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricFamily is the help and the type all metrics of the same name must have.
+type metricFamily struct {
+	help       string
+	metricType dto.MetricType
+}
+
+// familyMetric is a metric which remembers its name and family, prometheus.Desc has no accessors for them.
+// The metrics created by the converters are familyMetrics, see createPrometheusMetricWithLabels.
+type familyMetric struct {
+	prometheus.Metric
+	name   string
+	family metricFamily
+}
+
+func newFamilyMetric(m prometheus.Metric, name string, help string, metricType dto.MetricType) familyMetric {
+	return familyMetric{Metric: m, name: name, family: metricFamily{help: help, metricType: metricType}}
+}
+
+// metricTypeOf returns the type of the metric family of a value type.
+func metricTypeOf(valueType prometheus.ValueType) dto.MetricType {
+	switch valueType {
+	case prometheus.GaugeValue:
+		return dto.MetricType_GAUGE
+	case prometheus.CounterValue:
+		return dto.MetricType_COUNTER
+	default:
+		return dto.MetricType_UNTYPED
+	}
+}
+
+// exporterMetrics are the names of the metrics the exporter adds to every probe result, see
+// CommonStatusExporter.Collect. They aren't sent through metricFamilies, so lines creating metrics of
+// these names are always dropped.
+var exporterMetrics = map[string]bool{
+	"up":                             true,
+	"converted_metrics":              true,
+	"failed_metrics":                 true,
+	"probe_duration_seconds":         true,
+	"probe_ssl_earliest_cert_expiry": true,
+}
+
+// metricFamilies keeps the families and the series of the metrics collected from a CommonStatus page.
+// client_golang fails the whole scrape if metrics of the same name differ in help or type, e.g. the
+// Foo_a metric of a "Foo: a=1" line and of a "Foo_a: 2" line, or if a series is collected twice, e.g. from
+// two "Foo: a=1" lines, so the metrics of the later line are dropped.
+type metricFamilies struct {
+	families map[string]metricFamily
+	series   map[string]bool
+}
+
+func newMetricFamilies() *metricFamilies {
+	return &metricFamilies{families: map[string]metricFamily{}, series: map[string]bool{}}
+}
+
+// add remembers the families and the series of the metrics. It returns an error and adds none of them
+// if one of the metrics conflicts with a family added before or of the exporter, or duplicates a series
+// added before.
+func (f *metricFamilies) add(metrics ...prometheus.Metric) error {
+	addedFamilies := map[string]metricFamily{}
+	addedSeries := map[string]bool{}
+	for _, m := range metrics {
+		name, family, err := familyOf(m)
+		if err != nil {
+			return err
+		}
+		if exporterMetrics[name] {
+			return fmt.Errorf("metric %s conflicts with a metric of the exporter", name)
+		}
+		existing, ok := f.families[name]
+		if !ok {
+			existing, ok = addedFamilies[name]
+		}
+		if ok && existing != family {
+			return fmt.Errorf("metric %s with help %q and type %s conflicts with help %q and type %s of the metrics collected before",
+				name, family.help, family.metricType, existing.help, existing.metricType)
+		}
+		addedFamilies[name] = family
+
+		series, err := seriesOf(name, m)
+		if err != nil {
+			return err
+		}
+		if f.series[series] || addedSeries[series] {
+			return fmt.Errorf("metric %s was collected before", series)
+		}
+		addedSeries[series] = true
+	}
+
+	for name, family := range addedFamilies {
+		f.families[name] = family
+	}
+	for series := range addedSeries {
+		f.series[series] = true
+	}
+	return nil
+}
+
+// send runs the conversion and sends the metrics it creates to ch, no metrics are sent if the conversion
+// fails or if one of the metrics conflicts with a family or duplicates a series added before.
+func (f *metricFamilies) send(ch chan<- prometheus.Metric, convert func(ch chan<- prometheus.Metric) error) error {
+	lineCh := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lineCh)
+		errCh <- convert(lineCh)
+	}()
+
+	var metrics []prometheus.Metric
+	for m := range lineCh {
+		metrics = append(metrics, m)
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+	if err := f.add(metrics...); err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		ch <- m
+	}
+	return nil
+}
+
+// familyOf returns the name and the family recorded when the metric was created.
+func familyOf(m prometheus.Metric) (string, metricFamily, error) {
+	switch m := m.(type) {
+	case familyMetric:
+		return m.name, m.family, nil
+	case labeledMetric:
+		return familyOf(m.Metric)
+	default:
+		return "", metricFamily{}, fmt.Errorf("unknown family of the metric: %s", m.Desc())
+	}
+}
+
+// seriesOf returns the name and the labels of the metric in the text format, e.g. Foo_a{section="main"}.
+func seriesOf(name string, m prometheus.Metric) (string, error) {
+	out := dto.Metric{}
+	if err := m.Write(&out); err != nil {
+		return "", err
+	}
+	pairs := make([]string, 0, len(out.Label))
+	for _, l := range out.Label {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}", nil
+}
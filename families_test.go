@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustCreateMetric(name string, help string, value float64, labels prometheus.Labels, metricType prometheus.ValueType) prometheus.Metric {
+	m, err := createPrometheusMetricWithLabels(name, help, value, labels, metricType)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestMetricFamilies_add(t *testing.T) {
+	assert := assert.New(t)
+
+	families := newMetricFamilies()
+	fieldA := mustCreateMetric("Foo_a", "Field a of Foo", 1, nil, prometheus.GaugeValue)
+	fieldB := mustCreateMetric("Foo_b", "Field b of Foo", 2, nil, prometheus.GaugeValue)
+	assert.NoError(families.add(fieldA, fieldB))
+
+	labeled := labeledMetric{Metric: fieldA, labels: prometheus.Labels{"section": "main"}}
+	assert.NoError(families.add(labeled), "metrics of the same family may differ in labels")
+
+	tests := []prometheus.Metric{
+		mustCreateMetric("Foo_a", "", 3, prometheus.Labels{"section": "other"}, prometheus.GaugeValue),
+		mustCreateMetric("Foo_a", "Field a of Foo", 3, prometheus.Labels{"section": "other"}, prometheus.CounterValue),
+		mustCreateMetric("Foo_b", "Field \"b\" of Foo", 3, prometheus.Labels{"section": "other"}, prometheus.GaugeValue),
+		mustCreateMetric("Foo_a", "Field a of Foo", 3, nil, prometheus.GaugeValue),
+		mustCreateMetric("Foo_a", "Field a of Foo", 3, prometheus.Labels{"section": "main"}, prometheus.GaugeValue),
+		prometheus.MustNewConstMetric(prometheus.NewDesc("Foo_c", "Field c of Foo", nil, nil), prometheus.GaugeValue, 3),
+		mustCreateMetric("up", "", 5, nil, prometheus.GaugeValue),
+		mustCreateMetric("failed_metrics", "The number of CommonStatus metrics failed to convert to prometheus metrics", 5, prometheus.Labels{"section": "main"}, prometheus.GaugeValue),
+	}
+	for _, m := range tests {
+		assert.Error(families.add(m), "metric: %s", m.Desc())
+	}
+
+	fieldC := mustCreateMetric("Foo_c", "Field c of Foo", 3, nil, prometheus.GaugeValue)
+	assert.Error(families.add(fieldC, tests[0]))
+	assert.NotContains(families.families, "Foo_c", "no family should be added if one of the metrics conflicts")
+	assert.NoError(families.add(fieldC))
+
+	fieldD := mustCreateMetric("Foo_d", "Field d of Foo", 4, nil, prometheus.GaugeValue)
+	assert.Error(families.add(fieldD, fieldD), "a series should be added once")
+	assert.NotContains(families.families, "Foo_d")
+	assert.NoError(families.add(fieldD))
+}
+
+func TestMetricFamilies_send(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	families := newMetricFamilies()
+	err := families.send(ch, func(ch chan<- prometheus.Metric) error {
+		ch <- mustCreateMetric("Foo_a", "Field a of Foo", 1, nil, prometheus.GaugeValue)
+		return errors.New("invalid line")
+	})
+	assert.Error(err)
+	assert.Len(ch, 0, "no metrics should be sent if the conversion fails")
+	assert.Empty(families.families)
+	assert.Empty(families.series)
+
+	err = families.send(ch, func(ch chan<- prometheus.Metric) error {
+		ch <- mustCreateMetric("Foo_a", "Field a of Foo", 1, nil, prometheus.GaugeValue)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Len(ch, 1)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const keyValuePriority = 900
+
+// fieldPattern matches a key=value field, the keys are identifiers so that values like URLs
+// with a query string are not taken for fields.
+const fieldPattern = `[A-Za-z_][A-Za-z0-9_.]*=\S+`
+
+var (
+	keyValueLine   = regexp.MustCompile(`^(?P<name>[a-zA-Z_:].*?):\s+(?P<fields>` + fieldPattern + `(?:[ \t]+` + fieldPattern + `)*)$`)
+	fieldSeparator = regexp.MustCompile(`[ \t]+`)
+)
+
+func init() {
+	RegisterConverter("key_value", keyValuePriority, func(cfg ConversionConfig) Converter {
+		return keyValueConverter{cfg: cfg.KeyValue, values: valueParser{cfg: cfg.Values}}
+	})
+}
+
+// parseFields splits a "Name: k1=v1 k2=v2" line into the name and the fields. The order of the fields
+// doesn't matter, a line with a repeated field is not a key=value line.
+func parseFields(metric string) (string, map[string]string, bool) {
+	match := keyValueLine.FindStringSubmatch(metric)
+	if match == nil {
+		return "", nil, false
+	}
+	groups := namedGroups(keyValueLine, match)
+
+	fields := map[string]string{}
+	for _, field := range fieldSeparator.Split(groups["fields"], -1) {
+		kv := strings.SplitN(field, "=", 2)
+		if _, ok := fields[kv[0]]; ok {
+			return "", nil, false
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return groups["name"], fields, true
+}
+
+// keyValueConverter converts "Name: k1=v1 k2=v2" lines to a metric per field or, if a field label is
+// configured, to a single metric with a label per field. Counters get a _total suffix.
+type keyValueConverter struct {
+	cfg    KeyValueConfig
+	values valueParser
+}
+
+func (c keyValueConverter) Match(metric string) bool {
+	_, _, ok := parseFields(metric)
+	return ok
+}
+
+func (c keyValueConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	name, fields, ok := parseFields(metric)
+	if !ok {
+		return fmt.Errorf("the metric doesn't contain key=value fields: %s", metric)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// parse all values first, a line with an invalid value doesn't produce any metrics
+	values := make([]float64, len(keys))
+	for i, key := range keys {
+		value, err := c.values.parse(fields[key])
+		if err != nil {
+			return fmt.Errorf("can't parse field %s of %s: %v", key, name, err)
+		}
+		values[i] = value
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(keys))
+	for i, key := range keys {
+		metricName, help, labels := name+"_"+key, "Field "+key+" of "+name, prometheus.Labels(nil)
+		if c.cfg.FieldLabel != "" {
+			metricName, help, labels = name, "Fields of "+name, prometheus.Labels{c.cfg.FieldLabel: key}
+		}
+		metricType := c.cfg.typeOf(name, key)
+		if metricType == CounterMetricType {
+			metricName += "_total"
+		}
+
+		m, err := createPrometheusMetricWithLabels(metricName, help, values[i], labels, metricType.valueType())
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, m)
+	}
+
+	for _, m := range metrics {
+		ch <- m
+	}
+	return nil
+}
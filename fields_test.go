@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFields(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		metric string
+		name   string
+		fields map[string]string
+	}
+
+	tests := []testpair{
+		{"Queue: size=5 capacity=100", "Queue", map[string]string{"size": "5", "capacity": "100"}},
+		{"Queue: capacity=100 size=5", "Queue", map[string]string{"size": "5", "capacity": "100"}},
+		{"Queue:\tsize=5\t capacity=1,000", "Queue", map[string]string{"size": "5", "capacity": "1,000"}},
+		{"Cache_Products: hits=12 misses=3 ratio=0.8", "Cache_Products", map[string]string{"hits": "12", "misses": "3", "ratio": "0.8"}},
+	}
+
+	for _, test := range tests {
+		name, fields, ok := parseFields(test.metric)
+		assert.True(ok, "metric: %s", test.metric)
+		assert.Equal(test.name, name)
+		assert.Equal(test.fields, fields)
+	}
+
+	for _, metric := range []string{"Queue: 5", "Queue: size=5 full", "Queue: size=", "Queue: size=5 size=6", "Queue size=5", "Version: 1.2.3",
+		"Endpoint: http://catalog:8080/api?timeout=30", "Query: a+b=c", "Queue: 1size=5"} {
+		_, _, ok := parseFields(metric)
+		assert.False(ok, "metric: %s", metric)
+	}
+}
+
+func TestKeyValueConverter_fieldMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := KeyValueConfig{
+		FieldMaps: []FieldMap{
+			{Match: MustNewRegexp("Cache_.+"), Fields: map[string]MetricType{"hits": CounterMetricType, "misses": CounterMetricType}},
+			{Fields: map[string]MetricType{"hits": GaugeMetricType, "processed": CounterMetricType}},
+		},
+	}
+	c := keyValueConverter{cfg: cfg}
+
+	ch := make(chan prometheus.Metric, 6)
+	defer close(ch)
+
+	assert.True(c.Match("Cache_Products: ratio=0.8 misses=3 hits=12"))
+	assert.NoError(c.Convert("Cache_Products: ratio=0.8 misses=3 hits=12", ch))
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Cache_Products_hits_total", "Field hits of Cache_Products", nil, nil), prometheus.CounterValue, 12), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Cache_Products_misses_total", "Field misses of Cache_Products", nil, nil), prometheus.CounterValue, 3), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Cache_Products_ratio", "Field ratio of Cache_Products", nil, nil), prometheus.GaugeValue, 0.8), <-ch)
+
+	assert.NoError(c.Convert("Worker: processed=1,024 hits=7 queued=2", ch))
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker_hits", "Field hits of Worker", nil, nil), prometheus.GaugeValue, 7), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker_processed_total", "Field processed of Worker", nil, nil), prometheus.CounterValue, 1024), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker_queued", "Field queued of Worker", nil, nil), prometheus.GaugeValue, 2), <-ch)
+}
+
+func TestKeyValueConverter_fieldLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := KeyValueConfig{
+		FieldLabel: "field",
+		FieldMaps:  []FieldMap{{Fields: map[string]MetricType{"processed": CounterMetricType}}},
+	}
+	c := keyValueConverter{cfg: cfg, values: valueParser{cfg: ValuesConfig{Durations: true}}}
+
+	ch := make(chan prometheus.Metric, 3)
+	defer close(ch)
+
+	assert.NoError(c.Convert("Worker: queued=2 latency=15ms processed=1,024", ch))
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker", "Fields of Worker", nil, prometheus.Labels{"field": "latency"}), prometheus.GaugeValue, 0.015), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker_total", "Fields of Worker", nil, prometheus.Labels{"field": "processed"}), prometheus.CounterValue, 1024), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Worker", "Fields of Worker", nil, prometheus.Labels{"field": "queued"}), prometheus.GaugeValue, 2), <-ch)
+}
+
+func TestKeyValueConverter_invalidValue(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	err := keyValueConverter{}.Convert("Worker: queued=2 state=running", ch)
+	assert.Error(err)
+	assert.Len(ch, 0, "a line with an invalid value should not produce any metrics")
+}
+
+func TestConvertMetric_keyValue(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	converters := newConverters(ConversionConfig{})
+	assert.NoError(convertMetric("Queue: size=5 capacity=100", converters, ch))
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Queue_capacity", "Field capacity of Queue", nil, nil), prometheus.GaugeValue, 100), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Queue_size", "Field size of Queue", nil, nil), prometheus.GaugeValue, 5), <-ch)
+}
+
+func TestConvertMetric_urlValue(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	err := convertMetric("Endpoint: http://catalog:8080/api?timeout=30", newConverters(ConversionConfig{}), ch)
+	assert.Error(err)
+	assert.Len(ch, 0, "a URL value should not be converted to key=value fields")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// InputFormat is a format of the CommonStatus page.
+type InputFormat string
+
+// Supported formats of the CommonStatus page.
+const (
+	TextInputFormat InputFormat = "text"
+	JSONInputFormat InputFormat = "json"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (f *InputFormat) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch format := InputFormat(s); format {
+	case TextInputFormat, JSONInputFormat:
+		*f = format
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", s)
+	}
+}
+
+// isJSON returns whether the page is JSON, the Content-Type is only used if the format isn't configured.
+func (f InputFormat) isJSON(contentType string) bool {
+	if f != "" {
+		return f == JSONInputFormat
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Ways to flatten the keys of nested JSON objects.
+const (
+	namesNestedKeys    = "names"
+	sectionsNestedKeys = "sections"
+)
+
+// JSONConfig configures how JSON pages are converted to CommonStatus lines.
+type JSONConfig struct {
+	// names joins the keys of nested objects to the name, e.g. {"GC": {"PS_Scavenge": {"Count": 5}}} is GC_PS_Scavenge_Count: 5.
+	// sections puts the fields of a nested object into a section named by its key, the keys of the parents
+	// are joined to the name, e.g. {"Pools": {"main": {"Active": 5}}} is Pools_Active: 5 in the main section.
+	// Defaults to names.
+	NestedKeys string `yaml:"nested_keys,omitempty"`
+	// Separator of the joined keys, defaults to _.
+	Separator string `yaml:"separator,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *JSONConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain JSONConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.NestedKeys != "" && s.NestedKeys != namesNestedKeys && s.NestedKeys != sectionsNestedKeys {
+		return fmt.Errorf("unknown nested_keys: %s", s.NestedKeys)
+	}
+	return nil
+}
+
+func (s JSONConfig) separator() string {
+	if s.Separator == "" {
+		return "_"
+	}
+	return s.Separator
+}
+
+// jsonLines converts a JSON object to CommonStatus lines, so that it's converted by the same converters
+// as the text pages. Nested keys are flattened, null values are skipped and the elements of arrays
+// are keyed by their index. The lines of sections follow the lines without a section.
+// JSON numbers are written with the decimal separator of the number format the lines are parsed with,
+// booleans are written as 1 and 0.
+func jsonLines(r io.Reader, cfg JSONConfig, format numberFormat) (io.Reader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("the JSON page must be an object, got %v", tok)
+	}
+
+	f := &jsonFlattener{cfg: cfg, format: format, dec: dec, sections: map[string][]string{}}
+	if err := f.object(nil); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+
+	var buf bytes.Buffer
+	for _, line := range f.lines {
+		fmt.Fprintln(&buf, line)
+	}
+	for _, section := range f.order {
+		fmt.Fprintf(&buf, "[%s]\n", section)
+		for _, line := range f.sections[section] {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	return &buf, nil
+}
+
+// lineBreaks replaces the line breaks in keys and string values, a line break would start another line.
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+type jsonFlattener struct {
+	cfg      JSONConfig
+	format   numberFormat
+	dec      *json.Decoder
+	lines    []string
+	order    []string
+	sections map[string][]string
+}
+
+// object reads the fields of an object until its closing brace, the opening brace is already read.
+func (f *jsonFlattener) object(path []string) error {
+	for f.dec.More() {
+		tok, err := f.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := f.value(append(path, lineBreaks.Replace(tok.(string)))); err != nil {
+			return err
+		}
+	}
+	_, err := f.dec.Token()
+	return err
+}
+
+// array reads the elements of an array until its closing bracket, the opening bracket is already read.
+func (f *jsonFlattener) array(path []string) error {
+	for i := 0; f.dec.More(); i++ {
+		if err := f.value(append(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	_, err := f.dec.Token()
+	return err
+}
+
+func (f *jsonFlattener) value(path []string) error {
+	tok, err := f.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return f.object(path)
+		}
+		return f.array(path)
+	case json.Number:
+		// JSON numbers have no grouping separators, only the decimal point depends on the number format
+		f.add(path, strings.Replace(v.String(), ".", f.format.decimal, 1))
+	case string:
+		f.add(path, lineBreaks.Replace(v))
+	case bool:
+		if v {
+			f.add(path, "1")
+		} else {
+			f.add(path, "0")
+		}
+	}
+	return nil
+}
+
+func (f *jsonFlattener) add(path []string, value string) {
+	if f.cfg.NestedKeys != sectionsNestedKeys || len(path) == 1 {
+		f.lines = append(f.lines, strings.Join(path, f.cfg.separator())+": "+value)
+		return
+	}
+
+	section := path[len(path)-2]
+	name := strings.Join(append(path[:len(path)-2:len(path)-2], path[len(path)-1]), f.cfg.separator())
+	if _, ok := f.sections[section]; !ok {
+		f.order = append(f.order, section)
+	}
+	f.sections[section] = append(f.sections[section], name+": "+value)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLines(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		cfg   JSONConfig
+		input string
+		want  string
+	}
+
+	tests := []testpair{
+		{
+			JSONConfig{},
+			`{"ThreadCount": 3009, "LoadAvg": "1.94 3.44 5.07", "Maintenance": false, "Unset": null, "Ratio": 1.5e-3}`,
+			"ThreadCount: 3009\nLoadAvg: 1.94 3.44 5.07\nMaintenance: 0\nRatio: 1.5e-3\n",
+		},
+		{
+			JSONConfig{},
+			`{"GC": {"PS_Scavenge": {"Count": 5050, "Time": 1824745}}, "Ports": [8080, 8443], "ThreadCount": 3009}`,
+			"GC_PS_Scavenge_Count: 5050\nGC_PS_Scavenge_Time: 1824745\nPorts_0: 8080\nPorts_1: 8443\nThreadCount: 3009\n",
+		},
+		{
+			JSONConfig{Separator: "."},
+			`{"Cache": {"Products": {"Size": 12}}}`,
+			"Cache.Products.Size: 12\n",
+		},
+		{
+			JSONConfig{NestedKeys: "sections"},
+			`{"ThreadCount": 3009, "Pools": {"main": {"Active": 5}, "reporting": {"Active": 2}}, "Caches": {"Size": 12}, "Uptime": 5}`,
+			"ThreadCount: 3009\nUptime: 5\n[main]\nPools_Active: 5\n[reporting]\nPools_Active: 2\n[Caches]\nSize: 12\n",
+		},
+		{
+			JSONConfig{},
+			`{"ReleaseTag": "v1.2\nbeta", "Empty": {}}`,
+			"ReleaseTag: v1.2 beta\n",
+		},
+		{
+			JSONConfig{},
+			`{"A\nReleaseTag": "x", "Pools": {"main\r\n[other]": {"Active": 5}}}`,
+			"A ReleaseTag: x\nPools_main  [other]_Active: 5\n",
+		},
+	}
+
+	for _, test := range tests {
+		r, err := jsonLines(strings.NewReader(test.input), test.cfg, defaultNumberFormat)
+		assert.NoError(err, "input: %s", test.input)
+		if err != nil {
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		assert.NoError(err)
+		assert.Equal(test.want, string(got), "input: %s", test.input)
+	}
+}
+
+func TestJSONLines_locale(t *testing.T) {
+	assert := assert.New(t)
+
+	values := ValuesConfig{Locale: "de"}
+	r, err := jsonLines(strings.NewReader(`{"Ratio": 1.234, "Half": 0.5, "Total": 1234567.5, "Small": -1.5e-3, "Count": 1234567, "Maintenance": true}`), JSONConfig{}, values.numberFormat())
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(err)
+
+	want := map[string]float64{"Ratio": 1.234, "Half": 0.5, "Total": 1234567.5, "Small": -1.5e-3, "Count": 1234567, "Maintenance": 1}
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	assert.Len(lines, len(want))
+	for _, line := range lines {
+		m := metricTemplate.FindStringSubmatch(line)
+		if !assert.NotNil(m, "line: %s", line) {
+			continue
+		}
+		value, err := valueParser{cfg: values}.parse(m[2])
+		assert.NoError(err, "line: %s", line)
+		assert.Equal(want[m[1]], value, "line: %s", line)
+	}
+}
+
+func TestJSONLines_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, input := range []string{"", "ThreadCount: 3009", "[1, 2]", "42", `{"ThreadCount": 3009`, `{"ThreadCount": 3009} {}`} {
+		_, err := jsonLines(strings.NewReader(input), JSONConfig{}, defaultNumberFormat)
+		assert.Error(err, "input: %s", input)
+	}
+}
+
+func TestInputFormat_isJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		format      InputFormat
+		contentType string
+		want        bool
+	}
+
+	tests := []testpair{
+		{"", "application/json", true},
+		{"", "application/json; charset=utf-8", true},
+		{"", "application/vnd.commonstatus+json", true},
+		{"", "text/plain", false},
+		{"", "", false},
+		{TextInputFormat, "application/json", false},
+		{JSONInputFormat, "text/plain", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(test.want, test.format.isJSON(test.contentType), "format: %q, content type: %q", test.format, test.contentType)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	gcPriority     = 500
+	memoryPriority = 510
+)
+
+var (
+	gcLine           = regexp.MustCompile(`^GC[_-](?P<gc>.+)[_-](?P<field>Count|Time|AvgTime|AvgInterval):\s+(?P<value>.+)$`)
+	gcStatisticsLine = regexp.MustCompile(`^GC[_-]StatisticsAge:\s+(?P<value>.+)$`)
+	memoryLine       = regexp.MustCompile(`^Memory(?P<field>Used|Max):\s+(?P<value>.+)$`)
+)
+
+// gcMetric describes the metric created from a field of the GC_<collector>_<field> lines.
+// Divisor converts the milliseconds reported by CommonStatus to seconds.
+type gcMetric struct {
+	name       string
+	help       string
+	metricType prometheus.ValueType
+	divisor    float64
+}
+
+var gcMetrics = map[string]gcMetric{
+	"Count":       {"jvm_gc_collections_total", "Number of collections of the garbage collector", prometheus.CounterValue, 1},
+	"Time":        {"jvm_gc_collection_seconds_total", "Accumulated collection time of the garbage collector in seconds", prometheus.CounterValue, 1000},
+	"AvgTime":     {"jvm_gc_collection_average_seconds", "Average collection time of the garbage collector in seconds", prometheus.GaugeValue, 1000},
+	"AvgInterval": {"jvm_gc_collection_average_interval_seconds", "Average interval between collections of the garbage collector in seconds", prometheus.GaugeValue, 1000},
+}
+
+func init() {
+	RegisterConverter("jvm_gc", gcPriority, func(cfg ConversionConfig) Converter {
+		return gcConverter{values: valueParser{cfg: cfg.Values}}
+	})
+	RegisterConverter("jvm_memory", memoryPriority, func(cfg ConversionConfig) Converter {
+		return memoryConverter{cfg: cfg.Memory, values: valueParser{cfg: cfg.Values}}
+	})
+}
+
+// gcConverter converts the GC_<collector>_<field> lines to JVM metrics with a gc label per collector.
+type gcConverter struct {
+	values valueParser
+}
+
+func (c gcConverter) Match(metric string) bool {
+	return gcLine.MatchString(metric) || gcStatisticsLine.MatchString(metric)
+}
+
+func (c gcConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	if m := gcStatisticsLine.FindStringSubmatch(metric); m != nil {
+		value, err := c.values.number(m[1])
+		if err != nil {
+			return err
+		}
+		promMetric, err := createPrometheusMetric("jvm_gc_statistics_age_seconds", "Age of the garbage collection statistics in seconds", value/1000, prometheus.GaugeValue)
+		if err != nil {
+			return err
+		}
+		ch <- promMetric
+		return nil
+	}
+
+	m := gcLine.FindStringSubmatch(metric)
+	if m == nil {
+		return fmt.Errorf("the metric doesn't contain a GC statistic: %s", metric)
+	}
+	fields := namedGroups(gcLine, m)
+
+	value, err := c.values.number(fields["value"])
+	if err != nil {
+		return err
+	}
+
+	gc := gcMetrics[fields["field"]]
+	labels := prometheus.Labels{"gc": strings.Replace(fields["gc"], "-", "_", -1)}
+	promMetric, err := createPrometheusMetricWithLabels(gc.name, gc.help, value/gc.divisor, labels, gc.metricType)
+	if err != nil {
+		return err
+	}
+
+	ch <- promMetric
+	return nil
+}
+
+var memoryMetrics = map[string]struct {
+	name string
+	help string
+}{
+	"Used": {"jvm_memory_bytes_used", "Used bytes of a given JVM memory area."},
+	"Max":  {"jvm_memory_bytes_max", "Max (bytes) of a given JVM memory area."},
+}
+
+// memoryConverter converts the MemoryUsed and MemoryMax lines to JVM memory metrics in bytes.
+type memoryConverter struct {
+	cfg    MemoryConfig
+	values valueParser
+}
+
+func (c memoryConverter) Match(metric string) bool {
+	return memoryLine.MatchString(metric)
+}
+
+func (c memoryConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	m := memoryLine.FindStringSubmatch(metric)
+	if m == nil {
+		return fmt.Errorf("the metric doesn't contain a memory statistic: %s", metric)
+	}
+	fields := namedGroups(memoryLine, m)
+
+	value, err := parseBytes(fields["value"], c.values.cfg.numberFormat())
+	if err != nil {
+		return err
+	}
+
+	var labels prometheus.Labels
+	if c.cfg.Area != "" {
+		labels = prometheus.Labels{"area": c.cfg.Area}
+	}
+
+	memory := memoryMetrics[fields["field"]]
+	promMetric, err := createPrometheusMetricWithLabels(memory.name, memory.help, value, labels, prometheus.GaugeValue)
+	if err != nil {
+		return err
+	}
+
+	ch <- promMetric
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCConverter_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		metric string
+		want   prometheus.Metric
+	}
+
+	scavenge := prometheus.Labels{"gc": "PS_Scavenge"}
+	markSweep := prometheus.Labels{"gc": "PS_MarkSweep"}
+
+	tests := []testpair{
+		{
+			"GC_PS_Scavenge_Count: 5050",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_gc_collections_total", "Number of collections of the garbage collector", nil, scavenge),
+				prometheus.CounterValue,
+				5050,
+			),
+		},
+		{
+			"GC_PS_Scavenge_Time: 1824745",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_gc_collection_seconds_total", "Accumulated collection time of the garbage collector in seconds", nil, scavenge),
+				prometheus.CounterValue,
+				float64(1824745.0/1000.0),
+			),
+		},
+		{
+			"GC_PS_MarkSweep_AvgTime: 6353",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_gc_collection_average_seconds", "Average collection time of the garbage collector in seconds", nil, markSweep),
+				prometheus.GaugeValue,
+				float64(6353.0/1000.0),
+			),
+		},
+		{
+			"GC-PS-MarkSweep_AvgInterval: 2,906,504",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_gc_collection_average_interval_seconds", "Average interval between collections of the garbage collector in seconds", nil, markSweep),
+				prometheus.GaugeValue,
+				float64(2906504.0/1000.0),
+			),
+		},
+		{
+			"GC_StatisticsAge: 357500109",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_gc_statistics_age_seconds", "Age of the garbage collection statistics in seconds", nil, nil),
+				prometheus.GaugeValue,
+				float64(357500109.0/1000.0),
+			),
+		},
+	}
+
+	c := gcConverter{}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 1)
+		defer close(ch)
+
+		assert.True(c.Match(test.metric), "GC converter should match: %s", test.metric)
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		compareMetrics(t, test.want, <-ch)
+	}
+
+	assert.False(c.Match("GC_PS_Scavenge_Unknown: 1"))
+	assert.False(c.Match("ThreadCount: 3009"))
+}
+
+func TestMemoryConverter_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		cfg    MemoryConfig
+		metric string
+		want   prometheus.Metric
+	}
+
+	tests := []testpair{
+		{
+			MemoryConfig{},
+			"MemoryUsed: 9,220,838,392",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_memory_bytes_used", "Used bytes of a given JVM memory area.", nil, nil),
+				prometheus.GaugeValue,
+				9220838392,
+			),
+		},
+		{
+			MemoryConfig{Area: "heap"},
+			"MemoryMax: 18,312,855,552",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_memory_bytes_max", "Max (bytes) of a given JVM memory area.", nil, prometheus.Labels{"area": "heap"}),
+				prometheus.GaugeValue,
+				18312855552,
+			),
+		},
+		{
+			MemoryConfig{},
+			"MemoryUsed: 512 MB",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("jvm_memory_bytes_used", "Used bytes of a given JVM memory area.", nil, nil),
+				prometheus.GaugeValue,
+				512*1024*1024,
+			),
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 1)
+		defer close(ch)
+
+		c := memoryConverter{cfg: test.cfg}
+		assert.True(c.Match(test.metric))
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		compareMetrics(t, test.want, <-ch)
+	}
+
+	err := memoryConverter{}.Convert("MemoryUsed: lots", make(chan prometheus.Metric, 1))
+	assert.Error(err)
+}
@@ -3,12 +3,20 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -19,14 +27,23 @@ import (
 )
 
 var metricPattern = regexp.MustCompile(`^([a-zA-Z_:].*):\s+(.+)$`)
+var targetUserInfo = regexp.MustCompile(`^([^/]*//)[^/]*@`)
 var logger log.Logger
 var timeoutSeconds float64
+var configFile = flag.String("config.file", "", "Path to the YAML configuration file with probe modules")
+var webConfigFile = flag.String("web.config.file", "", "Path to the YAML configuration file with TLS and basic auth of the exporter's endpoints")
+var sc = &SafeConfig{C: defaultConfig()}
 var (
 	up = prometheus.NewDesc(
 		"up",
 		"Was talking to application successfull",
 		nil, nil,
 	)
+	sslEarliestCertExpiry = prometheus.NewDesc(
+		"probe_ssl_earliest_cert_expiry",
+		"Returns earliest SSL cert expiry date of the target in unixtime",
+		nil, nil,
+	)
 	probeSuccessCount = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "probe_success_total",
 		Help: "Displays count of successfull probes",
@@ -39,12 +56,34 @@ var (
 		Name: "probe_seconds_total",
 		Help: "Displays total duration of all probes",
 	})
+	unknownTimeZoneCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "startup_time_unknown_zone_total",
+		Help: "Displays count of StartupTime values with an unknown time zone abbreviation",
+	})
+	targetRejectedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "probe_target_rejected_total",
+		Help: "Displays count of probes of targets which are not allowed, by the reason of the rejection",
+	}, []string{"reason"})
+	ambiguousValueCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ambiguous_number_values_total",
+		Help: "Displays count of numbers which don't match the number format of the module",
+	})
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload",
+	})
 )
 
 type CommonStatusExporter struct {
 	hostURL        string
 	metricsScanner *bufio.Scanner
 	startTime      time.Time
+	module         Module
+	tlsState       *tls.ConnectionState
 }
 
 func init() {
@@ -55,6 +94,11 @@ func init() {
 	prometheus.MustRegister(probeSuccessCount)
 	prometheus.MustRegister(probeFailureCount)
 	prometheus.MustRegister(probeDurationCount)
+	prometheus.MustRegister(unknownTimeZoneCount)
+	prometheus.MustRegister(targetRejectedCount)
+	prometheus.MustRegister(ambiguousValueCount)
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
 
 	var err error
 	timeoutSeconds, err = strconv.ParseFloat(getEnv("CS_CONNECTION_TIMEOUT", "8.0"), 64)
@@ -110,28 +154,67 @@ func (c CommonStatusExporter) Collect(ch chan<- prometheus.Metric) {
 	s := c.metricsScanner
 	s.Split(bufio.ScanLines)
 
+	// converters can keep state between lines, they are created for every collection
+	converters := newConverters(c.module.Conversion)
+
 	// iterate over lines
 	var converted, failed float64
-	for s.Scan() {
-		metric := s.Text()
+	families := newMetricFamilies()
+	sections := &sectionTracker{}
+	// the section tracker needs the following line to tell a block header from a line with an empty value
+	hasLine := s.Scan()
+	for hasLine {
+		line := s.Text()
+		following := ""
+		if hasLine = s.Scan(); hasLine {
+			following = s.Text()
+		}
+
+		metric, isHeader := sections.next(line, following)
+		if isHeader {
+			level.Debug(logger).Log("msg", "entering a new section", "section", sections.section(), "host", c.hostURL)
+			continue
+		}
+		labels := c.module.Conversion.Sections.labels(sections.section())
 		level.Debug(logger).Log("msg", "received a new metric", "metric", metric, "host", c.hostURL)
-		if isValidMetric(metric) && len(metric) > 0 {
+		if c.module.Conversion.isIgnored(metric) {
+			level.Debug(logger).Log("msg", "the metric is ignored by the module", "metric", metric)
+			continue
+		}
+		if dc, ok := defaultConversion(metric, converters); ok && isValidMetric(metric) && len(metric) > 0 {
 			name := metricPattern.FindStringSubmatch(metric)[1]
 			value := metricPattern.FindStringSubmatch(metric)[2]
-			floatValue, err := strconv.ParseFloat(value, 64)
+			floatValue, err := dc.values.number(value)
 			if err != nil {
 				level.Debug(logger).Log("msg", "error converting to float64", "metric", metric, "err", err)
 				failed++
 				continue
 			}
 
-			desc := prometheus.NewDesc(name, "", nil, nil)
-			ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, floatValue)
+			promMetric, err := dc.createMetric(name, floatValue)
+			if err != nil {
+				level.Debug(logger).Log("msg", "error creating metric", "metric", metric, "err", err)
+				failed++
+				continue
+			}
+			if labels != nil {
+				promMetric = labeledMetric{Metric: promMetric, labels: labels}
+			}
+			if err := families.add(promMetric); err != nil {
+				level.Debug(logger).Log("msg", "error adding metric", "metric", metric, "err", err)
+				failed++
+				continue
+			}
+			ch <- promMetric
 			converted++
 			level.Debug(logger).Log("msg", "successfully added metric to the registry", "metric", metric)
 		} else {
 			level.Debug(logger).Log("msg", "the metric is not valid, trying to convert it", "metric", metric)
-			err := convertMetric(metric, ch)
+			err := families.send(ch, func(ch chan<- prometheus.Metric) error {
+				return withLabels(labels, ch, func(ch chan<- prometheus.Metric) error {
+					return convertMetric(metric, converters, ch)
+				})
+			})
 			if err != nil {
 				level.Debug(logger).Log("msg", "failed to convert metric", "metric", metric, "err", err)
 				failed++
@@ -143,6 +226,24 @@ func (c CommonStatusExporter) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 
+	for _, converter := range converters {
+		if f, ok := converter.(Flusher); ok {
+			if err := families.send(ch, f.Flush); err != nil {
+				level.Debug(logger).Log("msg", "failed to flush converter", "err", err)
+				failed++
+			}
+		}
+	}
+
+	if tag, ok := releaseTagOf(converters); ok {
+		err := families.send(ch, func(ch chan<- prometheus.Metric) error {
+			return releases.collect(c.hostURL, tag, ch)
+		})
+		if err != nil {
+			level.Debug(logger).Log("msg", "failed to track the release", "release_tag", tag, "err", err)
+		}
+	}
+
 	convertedMetricsGauge := prometheus.NewDesc("converted_metrics", "The number of CommonStatus metrics converted to prometheus metrics", nil, nil)
 	ch <- prometheus.MustNewConstMetric(convertedMetricsGauge, prometheus.GaugeValue, converted)
 	failedMetricsGauge := prometheus.NewDesc("failed_metrics", "The number of CommonStatus metrics failed to convert to prometheus metrics", nil, nil)
@@ -151,6 +252,10 @@ func (c CommonStatusExporter) Collect(ch chan<- prometheus.Metric) {
 	probeDurationGauge := prometheus.NewDesc("probe_duration_seconds", "Duration of the probe in seconds", nil, nil)
 	ch <- prometheus.MustNewConstMetric(probeDurationGauge, prometheus.GaugeValue, time.Since(c.startTime).Seconds())
 
+	if c.tlsState != nil && len(c.tlsState.PeerCertificates) > 0 {
+		ch <- prometheus.MustNewConstMetric(sslEarliestCertExpiry, prometheus.GaugeValue, float64(earliestCertExpiry(c.tlsState).Unix()))
+	}
+
 	// check if errors ocurred during reading - e.g dropped connection or etc.
 	if err := s.Err(); err != nil {
 		level.Warn(logger).Log("msg", "error ocurred during reading the response body", "err", err)
@@ -163,75 +268,172 @@ func (c CommonStatusExporter) Collect(ch chan<- prometheus.Metric) {
 	level.Info(logger).Log("msg", "collect succeeded", "host", c.hostURL, "coverted_metrics", converted, "failed_metrics", failed)
 }
 
+// rejectTarget responds to a probe of a target which is not in the allowlist.
+func rejectTarget(w http.ResponseWriter, start time.Time, err error, url string) {
+	reason := hostRejection
+	if rejection, ok := err.(*targetRejection); ok {
+		reason = rejection.reason
+	}
+	targetRejectedCount.WithLabelValues(reason).Inc()
+	http.Error(w, "Target is not allowed", http.StatusForbidden)
+	probeFailure(start, "target is not allowed", err, url)
+}
+
 func probeFailure(start time.Time, msg string, err error, url string) {
 	level.Warn(logger).Log("msg", msg, "err", err, "URL", url)
 	probeFailureCount.Inc()
 	probeDurationCount.Add(time.Since(start).Seconds())
 }
 
+// redactedURL returns the URL of the probe request without the passwords of its target parameters.
+func redactedURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for i, target := range query["target"] {
+		if redactedTarget(target) != target {
+			query["target"][i] = redactedTarget(target)
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// redactedTarget returns the target without its user info, the user name alone may be a token.
+func redactedTarget(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return targetUserInfo.ReplaceAllString(target, "${1}xxxxx@")
+	}
+	if u.User == nil {
+		return target
+	}
+	u.User = url.User("xxxxx")
+	return u.String()
+}
+
 func probeHandler(w http.ResponseWriter, r *http.Request) {
-	requestURL := r.URL
+	requestURL := redactedURL(r.URL)
 	start := time.Now()
-	level.Info(logger).Log("msg", "probe started", "URL", requestURL.String())
+	level.Info(logger).Log("msg", "probe started", "URL", requestURL)
+
+	query := r.URL.Query()
+	for param := range query {
+		if param != "target" && param != "module" {
+			http.Error(w, "Request should contain only 'target' and optional 'module' parameters. Encode the URL if needed.", http.StatusBadRequest)
+			probeFailure(start, "unknown parameter found in the request URL", fmt.Errorf("unknown parameter: %s", param), requestURL)
+			return
+		}
+	}
+	target := query.Get("target")
+	if target == "" {
+		http.Error(w, "Parameter 'target' is missing", http.StatusBadRequest)
+		probeFailure(start, "parameter 'target' is missing", nil, requestURL)
+		return
+	}
 
-	// If a timeout is configured via the Prometheus header, add it to the request.
+	moduleName := query.Get("module")
+	if moduleName == "" {
+		moduleName = defaultModuleName
+	}
+	module, ok := sc.Module(moduleName)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		probeFailure(start, "unknown module", fmt.Errorf("module %q is not configured", moduleName), requestURL)
+		return
+	}
+
+	// The timeout from the Prometheus header replaces the default timeout, the module's timeout is used
+	// if it's shorter than the timeout from the header.
+	timeout := time.Duration(timeoutSeconds * float64(time.Second))
 	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
-		var err error
-		timeoutSeconds, err = strconv.ParseFloat(v, 64)
+		headerTimeout, err := strconv.ParseFloat(v, 64)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to parse timeout from Prometheus header: %s", err), http.StatusInternalServerError)
-			probeFailure(start, "can't parse value of header X-Prometheus-Scrape-Timeout-Seconds", err, requestURL.String())
+			probeFailure(start, "can't parse value of header X-Prometheus-Scrape-Timeout-Seconds", err, requestURL)
 			return
 		}
+		timeout = time.Duration(headerTimeout * float64(time.Second))
+		if module.Timeout > 0 && module.Timeout < timeout {
+			timeout = module.Timeout
+		}
+	} else if module.Timeout > 0 {
+		timeout = module.Timeout
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds*float64(time.Second)))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	r = r.WithContext(ctx)
 
-	query := requestURL.Query()
-	if len(query) > 1 {
-		http.Error(w, "Request should contain only one parameter: 'target'. Encode the URL if needed.", http.StatusBadRequest)
-		probeFailure(start, "more than one parameter found in the request URL", nil, requestURL.String())
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		// the error of an invalid URL contains the whole URL including the password
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		http.Error(w, "Failed to create a request", http.StatusInternalServerError)
+		probeFailure(start, "failed to create a request", err, requestURL)
 		return
 	}
-	target := query.Get("target")
-	if target == "" {
-		http.Error(w, "Parameter 'target' is missing", http.StatusBadRequest)
-		probeFailure(start, "parameter 'target' is missing", nil, requestURL.String())
+	req = req.WithContext(ctx)
+	if err := module.HTTP.authorize(req); err != nil {
+		http.Error(w, "Failed to create a request", http.StatusInternalServerError)
+		probeFailure(start, "failed to authorize the request", err, requestURL)
 		return
 	}
-
-	req, err := http.NewRequest("GET", target, nil)
+	allowlist := sc.Allowlist()
+	if err := allowlist.check(ctx, req.URL); err != nil {
+		rejectTarget(w, start, err, requestURL)
+		return
+	}
+	client, err := newHTTPClient(module.HTTP, allowlist)
 	if err != nil {
-		http.Error(w, "Failed to create a request", http.StatusInternalServerError)
-		probeFailure(start, "failed to create a request", err, requestURL.String())
+		http.Error(w, "Failed to create a HTTP client", http.StatusInternalServerError)
+		probeFailure(start, "failed to create a HTTP client", err, requestURL)
 		return
 	}
-	req = req.WithContext(ctx)
-	client := http.DefaultClient
 	resp, err := client.Do(req)
 	if err != nil {
+		if rejection, ok := asTargetRejection(err); ok {
+			rejectTarget(w, start, rejection, requestURL)
+			return
+		}
 		http.Error(w, "Failed to execute a request", http.StatusBadGateway)
-		probeFailure(start, "failed to execute a request", err, requestURL.String())
+		probeFailure(start, "failed to execute a request", err, requestURL)
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if !module.HTTP.isValidStatusCode(resp.StatusCode) {
 		http.Error(w, "Server returned wrong response code", http.StatusBadGateway)
-		probeFailure(start, "HTTP response status code is not 200", fmt.Errorf("HTTP status code is: %v, expected '200 OK'", resp.StatusCode), requestURL.String())
+		probeFailure(start, "HTTP response status code is not valid", fmt.Errorf("HTTP status code is: %v, expected one of %v", resp.StatusCode, module.HTTP.validStatusCodes()), requestURL)
 		return
 	}
 
+	// JSON pages are converted to CommonStatus lines
+	var body io.Reader = resp.Body
+	if module.Format.isJSON(resp.Header.Get("Content-Type")) {
+		body, err = jsonLines(resp.Body, module.JSON, module.Conversion.Values.numberFormat())
+		if err != nil {
+			http.Error(w, "Failed to parse the JSON response", http.StatusBadGateway)
+			probeFailure(start, "failed to parse the JSON response", err, requestURL)
+			return
+		}
+	}
+
 	// Wrap response body into buffered scanner
-	s := bufio.NewScanner(resp.Body)
+	s := bufio.NewScanner(body)
 
 	registry := prometheus.NewRegistry()
 	c := CommonStatusExporter{
-		hostURL:        target,
+		hostURL:        redactedTarget(target),
 		metricsScanner: s,
 		startTime:      start,
+		module:         module,
+		tlsState:       resp.TLS,
 	}
 	registry.MustRegister(c)
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
@@ -241,16 +443,126 @@ func probeHandler(w http.ResponseWriter, r *http.Request) {
 	duration := time.Since(start).Seconds()
 	probeSuccessCount.Inc()
 	probeDurationCount.Add(duration)
-	level.Info(logger).Log("msg", "probe succeeded", "URL", requestURL.String(), "duration", fmt.Sprintf("%.2f s.", duration))
+	level.Info(logger).Log("msg", "probe succeeded", "URL", requestURL, "duration", fmt.Sprintf("%.2f s.", duration))
+}
+
+// reloadLoop serializes configuration reloads triggered by SIGHUP and the /-/reload endpoint.
+func reloadLoop(reloadCh chan chan error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for {
+		select {
+		case <-hup:
+			if err := reloadConfig(); err != nil {
+				level.Error(logger).Log("msg", "error reloading config", "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "reloaded config file", "file", *configFile)
+		case errCh := <-reloadCh:
+			if err := reloadConfig(); err != nil {
+				level.Error(logger).Log("msg", "error reloading config", "err", err)
+				errCh <- err
+				continue
+			}
+			level.Info(logger).Log("msg", "reloaded config file", "file", *configFile)
+			errCh <- nil
+		}
+	}
+}
+
+func reloadConfig() error {
+	if *configFile == "" {
+		return fmt.Errorf("the exporter is running without --config.file")
+	}
+	return sc.ReloadConfig(*configFile)
+}
+
+func reloadHandler(reloadCh chan chan error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "This endpoint requires a POST request.\n")
+			return
+		}
+
+		errCh := make(chan error)
+		reloadCh <- errCh
+		if err := <-errCh; err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	}
+}
+
+func newHTTPClient(cfg HTTPProbe, allowlist TargetAllowlist) (*http.Client, error) {
+	client := &http.Client{}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if cfg.NoFollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return allowlist.check(req.Context(), req.URL)
+	}
+	if cfg.TLSConfig.isEmpty() && len(allowlist.networks) == 0 {
+		return client, nil
+	}
+
+	// the transport is created for every probe, its connections are not reused
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   true,
+	}
+	if !cfg.TLSConfig.isEmpty() {
+		tlsConfig, err := newTLSConfig(cfg.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if len(allowlist.networks) > 0 {
+		// the addresses of the target are checked when connecting, a proxy would hide them
+		transport.Proxy = nil
+		transport.DialContext = allowlist.dialContext(&net.Dialer{Timeout: 30 * time.Second})
+	}
+	client.Transport = transport
+	return client, nil
 }
 
 func main() {
+	flag.Parse()
+
+	if *configFile != "" {
+		if err := sc.ReloadConfig(*configFile); err != nil {
+			level.Error(logger).Log("msg", "failed to load the config file", "file", *configFile, "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "loaded the config file", "file", *configFile)
+	} else {
+		sc.UseDefaultConfig()
+	}
+
+	webConfig := &WebConfig{}
+	if *webConfigFile != "" {
+		var err error
+		if webConfig, err = loadWebConfig(*webConfigFile); err != nil {
+			level.Error(logger).Log("msg", "failed to load the web config file", "file", *webConfigFile, "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "loaded the web config file", "file", *webConfigFile, "tls", webConfig.TLSServerConfig != nil, "basic_auth_users", len(webConfig.BasicAuthUsers))
+	}
+
+	reloadCh := make(chan chan error)
+	go reloadLoop(reloadCh)
+
 	// TODO: Documentation + demo setup
 	http.HandleFunc("/probe", probeHandler)
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/-/reload", reloadHandler(reloadCh))
 
 	port := getEnv("CS_PORT", "9259")
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := webConfig.listenAndServe(":"+port, http.DefaultServeMux); err != nil {
 		level.Error(logger).Log("msg", "failed to start the server", "err", err)
 		os.Exit(1)
 	}
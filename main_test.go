@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-kit/kit/log"
 )
 
 func TestCheckNumberOfQueryStrings(t *testing.T) {
@@ -180,3 +188,546 @@ func TestTimeoutFromHeaderUsed(t *testing.T) {
 		t.Errorf("probe request handler returned wrong status code: %v, want %v", status, http.StatusOK)
 	}
 }
+
+func TestShorterTimeoutUsed(t *testing.T) {
+	timeoutSeconds = 5
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+
+	type testpair struct {
+		moduleTimeout time.Duration
+		headerTimeout string
+	}
+
+	// the shorter of the module's timeout and the timeout from the header is used
+	tests := []testpair{
+		{time.Second, "3"},
+		{3 * time.Second, "1"},
+	}
+
+	for _, test := range tests {
+		sc.C = &Config{Modules: map[string]Module{"default": {Timeout: test.moduleTimeout}}}
+
+		req, err := http.NewRequest("GET", "?target="+ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", test.headerTimeout)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probeHandler(w, r)
+		})
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadGateway {
+			t.Errorf("probe request handler returned wrong status code with module timeout %s and header %s: %v, want %v", test.moduleTimeout, test.headerTimeout, status, http.StatusBadGateway)
+		}
+	}
+}
+
+func TestUnknownModule(t *testing.T) {
+	req, err := http.NewRequest("GET", "?target=http://localhost&module=foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("probe request handler returned wrong status code: %v, want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestModuleSelected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		w.Write([]byte("ThreadCount: 3009\nDebugFlag: on\n"))
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"custom": {
+				HTTP:       HTTPProbe{ValidStatusCodes: []int{203}},
+				Conversion: ConversionConfig{IgnoreLines: []Regexp{MustNewRegexp("Debug.*")}},
+			},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL+"&module=custom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("probe request handler returned wrong status code: %v, want %v", status, http.StatusOK)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "failed_metrics 0") {
+		t.Errorf("ignored line should not be counted as failed, got: %s", body)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	defer func(c *Config) { sc.C = c }(sc.C)
+	defer func(f string) { *configFile = f }(*configFile)
+	*configFile = "testdata/config_good.yml"
+
+	reloadCh := make(chan chan error)
+	go reloadLoop(reloadCh)
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{"GET", http.StatusMethodNotAllowed},
+		{"POST", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "/-/reload", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		reloadHandler(reloadCh).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.want {
+			t.Errorf("reload handler returned wrong status code for %s: %v, want %v", test.method, status, test.want)
+		}
+	}
+
+	if _, ok := sc.Module("catalog"); !ok {
+		t.Errorf("module 'catalog' should be loaded after the reload")
+	}
+
+	*configFile = "testdata/config_invalid_regexp.yml"
+	req, err := http.NewRequest("POST", "/-/reload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	reloadHandler(reloadCh).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("reload handler returned wrong status code for invalid config: %v, want %v", status, http.StatusInternalServerError)
+	}
+	if _, ok := sc.Module("catalog"); !ok {
+		t.Errorf("module 'catalog' should be kept after a failed reload")
+	}
+}
+
+func TestSectionLabels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ThreadCount: 3009\n[Datasource main]\nPool_Active: 5\n[ Datasource reporting ]\nPool_Active: 2\nCaches:\n  Cache_Size: 12\n\tCache_Lookups: hits=7 misses=1\nUptime: 5\n"))
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"custom": {Conversion: ConversionConfig{Sections: SectionsConfig{Label: "group"}}},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL+"&module=custom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"\nThreadCount 3009\n",
+		`Pool_Active{group="Datasource main"} 5`,
+		`Pool_Active{group="Datasource reporting"} 2`,
+		`Cache_Size{group="Caches"} 12`,
+		`Cache_Lookups_hits{group="Caches"} 7`,
+		`Uptime{group="Datasource reporting"} 5`,
+		"failed_metrics 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response should contain %q, got: %s", want, body)
+		}
+	}
+}
+
+func TestConversionRulesForFreeFormLines(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Pool main active=5\nUptime:7\n"))
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"custom": {Conversion: ConversionConfig{Rules: []ConversionRule{
+				{Match: MustNewRegexp(`Pool (?P<pool>\w+) active=(?P<value>\d+)`), Name: "pool_active", Type: GaugeMetricType, Value: "value", Scale: 1, Labels: map[string]string{"pool": "${pool}"}},
+				{Match: MustNewRegexp(`Uptime:(?P<value>\d+)`), Name: "uptime_seconds", Type: GaugeMetricType, Value: "value", Scale: 1},
+			}}},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL+"&module=custom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`pool_active{pool="main"} 5`,
+		"\nuptime_seconds 7\n",
+		"converted_metrics 2",
+		"failed_metrics 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response should contain %q, got: %s", want, body)
+		}
+	}
+}
+
+func TestIndentedSectionLines(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[Pool main]\n  Active: 5\n  Idle: 2\n[Pool b]\n  Active: 1\nPools:\n  jdbc:\n    Active: 3\n"))
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`Active{section="Pool main"} 5`,
+		`Idle{section="Pool main"} 2`,
+		`Active{section="Pool b"} 1`,
+		`Active{section="jdbc"} 3`,
+		"converted_metrics 4",
+		"failed_metrics 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response should contain %q, got: %s", want, body)
+		}
+	}
+}
+
+func TestConflictingMetricFamilies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Foo: a=1 b=2\nFoo_a: 3\nFoo: a=1 b=3\nup: 5\nThreadCount: 3009\n"))
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("probe request handler returned wrong status code: %v, want %v: %s", status, http.StatusOK, rr.Body.String())
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"\nFoo_a 1\n",
+		"\nFoo_b 2\n",
+		"\nThreadCount 3009\n",
+		"failed_metrics 3",
+		"\nup 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response should contain %q, got: %s", want, body)
+		}
+	}
+	if strings.Contains(body, "\nFoo_b 3\n") {
+		t.Errorf("probe response should not contain the metrics of a duplicate line, got: %s", body)
+	}
+}
+
+func TestJSONInput(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ThreadCount": 3009, "LoadAvg": "1.94 3.44 5.07", "Pools": {"main": {"Active": 5}}}`))
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"custom": {JSON: JSONConfig{NestedKeys: "sections"}},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL+"&module=custom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"\nThreadCount 3009\n",
+		"load_avertage1 1.94",
+		`Pools_Active{section="main"} 5`,
+		"failed_metrics 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("probe response should contain %q, got: %s", want, body)
+		}
+	}
+}
+
+func TestInvalidJSONInput(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ThreadCount: 3009\n"))
+	}))
+	defer ts.Close()
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"custom": {Format: JSONInputFormat},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "?target="+ts.URL+"&module=custom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r)
+	})
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadGateway {
+		t.Errorf("probe request handler returned wrong status code: %v, want %v", status, http.StatusBadGateway)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commonstatus_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwordFile, tokenFile := filepath.Join(dir, "password"), filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tokenFile, []byte("t0ken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		basicAuth := ok && user == "monitoring" && password == "s3cret"
+		bearer := r.Header.Get("Authorization") == "Bearer t0ken"
+		if !(basicAuth || bearer) || r.Header.Get("X-Tenant") != "shop" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ThreadCount: 3009\n"))
+	}))
+	defer ts.Close()
+
+	headers := map[string]string{"X-Tenant": "shop"}
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"basic":         {HTTP: HTTPProbe{BasicAuth: &BasicAuth{Username: "monitoring", PasswordFile: passwordFile}, Headers: headers}},
+			"bearer":        {HTTP: HTTPProbe{BearerTokenFile: tokenFile, Headers: headers}},
+			"no_headers":    {HTTP: HTTPProbe{BearerTokenFile: tokenFile}},
+			"missing_token": {HTTP: HTTPProbe{BearerTokenFile: filepath.Join(dir, "missing"), Headers: headers}},
+		},
+	}
+
+	type testpair struct {
+		module string
+		status int
+	}
+
+	tests := []testpair{
+		{"basic", http.StatusOK},
+		{"bearer", http.StatusOK},
+		{"no_headers", http.StatusBadGateway},
+		{"missing_token", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "?target="+ts.URL+"&module="+test.module, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probeHandler(w, r)
+		})
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("probe request handler returned wrong status code for module %s: %v, want %v", test.module, status, test.status)
+		}
+	}
+}
+
+func TestCredentialsNotLogged(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	defer func(l log.Logger) { logger = l }(logger)
+	logger = log.NewLogfmtLogger(&buf)
+
+	target := strings.Replace(ts.URL, "http://", "http://monitoring:s3cret@", 1)
+	tokenTarget := strings.Replace(ts.URL, "http://", "http://t0ken@", 1)
+	for _, rawQuery := range []string{"target=" + url.QueryEscape(target), "target=" + url.QueryEscape("http://monitoring:s3cret@ invalid"),
+		"target=" + url.QueryEscape(ts.URL) + "&target=" + url.QueryEscape(target), "target=" + url.QueryEscape(tokenTarget)} {
+		req, err := http.NewRequest("GET", "/probe?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probeHandler(w, r)
+		})
+
+		handler.ServeHTTP(rr, req)
+	}
+
+	for _, secret := range []string{"s3cret", "monitoring", "t0ken"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("logs should not contain the user info %q, got: %s", secret, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "%2F%2Fxxxxx%40") {
+		t.Errorf("logs should contain the redacted target, got: %s", buf.String())
+	}
+}
+
+func TestTargetRejected(t *testing.T) {
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ThreadCount: 3009\n"))
+	}))
+	defer allowed.Close()
+	internal := httptest.NewServer(allowed.Config.Handler)
+	defer internal.Close()
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	port := func(ts *httptest.Server) string {
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Port()
+	}
+
+	ports := newAllowlist(t, "{schemes: [http], ports: ["+port(allowed)+", "+port(redirecting)+"]}")
+
+	type testpair struct {
+		allowlist TargetAllowlist
+		target    string
+		status    int
+		reason    string
+	}
+
+	tests := []testpair{
+		{ports, allowed.URL, http.StatusOK, ""},
+		{ports, internal.URL, http.StatusForbidden, portRejection},
+		{ports, strings.Replace(allowed.URL, "http://", "ftp://", 1), http.StatusForbidden, schemeRejection},
+		{ports, redirecting.URL, http.StatusForbidden, portRejection},
+		// the addresses are checked again when connecting
+		{newAllowlist(t, "cidrs: [127.0.0.0/8]"), allowed.URL, http.StatusOK, ""},
+	}
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	for _, test := range tests {
+		sc.C = &Config{Modules: map[string]Module{"default": {}}, TargetAllowlist: test.allowlist}
+
+		req, err := http.NewRequest("GET", "?target="+url.QueryEscape(test.target), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var before float64
+		if test.reason != "" {
+			before = counterValue(targetRejectedCount.WithLabelValues(test.reason))
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probeHandler(w, r)
+		})
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("probe request handler returned wrong status code for target %s: %v, want %v", test.target, status, test.status)
+		}
+		if test.reason != "" && counterValue(targetRejectedCount.WithLabelValues(test.reason)) != before+1 {
+			t.Errorf("rejection of target %s should be counted with reason %s", test.target, test.reason)
+		}
+	}
+}
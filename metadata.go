@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricMetadata describes the CommonStatus lines converted by the default converter.
+type MetricMetadata struct {
+	// Expression matching the sanitized name of the metric.
+	Match Regexp     `yaml:"match"`
+	Type  MetricType `yaml:"type,omitempty"`
+	Help  string     `yaml:"help,omitempty"`
+	// Unit of the value, it's converted to the base unit and the unit suffix is added to the name.
+	Unit Unit `yaml:"unit,omitempty"`
+}
+
+// defaultMetadata is the built-in catalog of well-known CommonStatus keys.
+// The metadata of the module is looked up first.
+var defaultMetadata = []MetricMetadata{
+	{Match: MustNewRegexp(`MemoryUsed`), Type: GaugeMetricType, Help: "Used memory of the JVM in bytes"},
+	{Match: MustNewRegexp(`MemoryMax`), Type: GaugeMetricType, Help: "Maximal memory of the JVM in bytes"},
+	{Match: MustNewRegexp(`ThreadCount`), Type: GaugeMetricType, Help: "Current number of live threads"},
+	{Match: MustNewRegexp(`ThreadPeakCount`), Type: GaugeMetricType, Help: "Peak number of live threads"},
+	{Match: MustNewRegexp(`CPUCountFromProc`), Type: GaugeMetricType, Help: "Number of CPUs reported by /proc"},
+	{Match: MustNewRegexp(`CPUCountFromJava`), Type: GaugeMetricType, Help: "Number of CPUs reported by the JVM"},
+	{Match: MustNewRegexp(`MissingLocalizationCount`), Type: GaugeMetricType, Help: "Number of missing localizations"},
+	{Match: MustNewRegexp(`VeryLongActive`), Type: GaugeMetricType, Help: "Number of very long running active requests"},
+	{Match: MustNewRegexp(`GC_StatisticsAge`), Type: GaugeMetricType, Help: "Age of the garbage collection statistics in milliseconds"},
+	{Match: MustNewRegexp(`GC_.+_Count`), Type: CounterMetricType, Help: "Number of collections of the garbage collector"},
+	{Match: MustNewRegexp(`GC_.+_Time`), Type: CounterMetricType, Help: "Accumulated collection time of the garbage collector in milliseconds"},
+	{Match: MustNewRegexp(`GC_.+_AvgTime`), Type: GaugeMetricType, Help: "Average collection time of the garbage collector in milliseconds"},
+	{Match: MustNewRegexp(`GC_.+_AvgInterval`), Type: GaugeMetricType, Help: "Average interval between collections of the garbage collector in milliseconds"},
+}
+
+// metadataOf looks up the metadata of the metric in the module catalog, then in the built-in catalog.
+// Metrics without metadata are counters if their names end with _Count or _Time, gauges otherwise.
+func metadataOf(catalog []MetricMetadata, name string) MetricMetadata {
+	metadata := MetricMetadata{}
+	for _, catalog := range [][]MetricMetadata{catalog, defaultMetadata} {
+		if m, ok := findMetadata(catalog, name); ok {
+			metadata = m
+			break
+		}
+	}
+
+	if metadata.Type == "" {
+		metadata.Type = GaugeMetricType
+		if strings.HasSuffix(name, "_Count") || strings.HasSuffix(name, "_Time") {
+			metadata.Type = CounterMetricType
+		}
+	}
+	return metadata
+}
+
+func findMetadata(catalog []MetricMetadata, name string) (MetricMetadata, bool) {
+	for _, m := range catalog {
+		if m.Match.MatchString(name) {
+			return m, true
+		}
+	}
+	return MetricMetadata{}, false
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (m *MetricMetadata) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain MetricMetadata
+	if err := unmarshal((*plain)(m)); err != nil {
+		return err
+	}
+	if m.Match.Regexp == nil {
+		return fmt.Errorf("metadata is missing 'match'")
+	}
+	return nil
+}
+
+// createMetric creates the metric with the type, help and unit of its metadata.
+func (m MetricMetadata) createMetric(name string, value float64) (prometheus.Metric, error) {
+	if m.Unit != "" && m.Unit != NoneUnit {
+		name += m.Unit.suffix()
+		value /= m.Unit.divisor()
+	}
+	return createPrometheusMetric(name, m.Help, value, m.Type.valueType())
+}
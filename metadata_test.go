@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMetadataOf(t *testing.T) {
+	assert := assert.New(t)
+
+	catalog := []MetricMetadata{
+		{Match: MustNewRegexp(`ThreadCount`), Type: UntypedMetricType, Help: "Threads"},
+		{Match: MustNewRegexp(`Cache_.+`), Help: "Cache statistics"},
+	}
+
+	type testpair struct {
+		name string
+		want MetricMetadata
+	}
+
+	tests := []testpair{
+		{"ThreadCount", MetricMetadata{Type: UntypedMetricType, Help: "Threads"}},
+		{"ThreadPeakCount", MetricMetadata{Type: GaugeMetricType, Help: "Peak number of live threads"}},
+		{"Cache_Hit_Count", MetricMetadata{Type: CounterMetricType, Help: "Cache statistics"}},
+		{"Cache_Size", MetricMetadata{Type: GaugeMetricType, Help: "Cache statistics"}},
+		{"GC_G1_Young_Generation_Time", MetricMetadata{Type: CounterMetricType, Help: "Accumulated collection time of the garbage collector in milliseconds"}},
+		{"Reload_Time", MetricMetadata{Type: CounterMetricType}},
+		{"DuplicatesMatchedCount", MetricMetadata{Type: GaugeMetricType}},
+	}
+
+	for _, test := range tests {
+		result := metadataOf(catalog, test.name)
+		assert.Equal(test.want.Type, result.Type, "type of %s", test.name)
+		assert.Equal(test.want.Help, result.Help, "help of %s", test.name)
+	}
+}
+
+func TestMetadataCreateMetric_unit(t *testing.T) {
+	assert := assert.New(t)
+
+	c := defaultConverter{metadata: []MetricMetadata{
+		{Match: MustNewRegexp(`LastReloadDuration`), Type: GaugeMetricType, Help: "Duration of the last reload", Unit: MillisecondsUnit},
+		{Match: MustNewRegexp(`QueueLength`), Unit: NoneUnit},
+	}}
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	assert.NoError(c.Convert("LastReloadDuration: 1,500", ch))
+	assert.NoError(c.Convert("QueueLength: 7", ch))
+
+	compareMetrics(t, prometheus.MustNewConstMetric(
+		prometheus.NewDesc("LastReloadDuration_seconds", "Duration of the last reload", nil, nil),
+		prometheus.GaugeValue,
+		1.5,
+	), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(
+		prometheus.NewDesc("QueueLength", "", nil, nil),
+		prometheus.GaugeValue,
+		7,
+	), <-ch)
+}
+
+func TestMetricMetadata_unmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	var m MetricMetadata
+	err := yaml.UnmarshalStrict([]byte(`{match: "Cache_.+", type: counter, help: "Cache statistics", unit: us}`), &m)
+	assert.NoError(err)
+	assert.Equal(CounterMetricType, m.Type)
+	assert.Equal(MicrosecondsUnit, m.Unit)
+
+	tests := []struct {
+		metadata string
+		want     string
+	}{
+		{`{type: gauge}`, "missing 'match'"},
+		{`{match: "Foo", type: histogram}`, "unknown type: histogram"},
+		{`{match: "Foo", unit: hours}`, "unknown unit: hours"},
+	}
+
+	for _, test := range tests {
+		var m MetricMetadata
+		err := yaml.UnmarshalStrict([]byte(test.metadata), &m)
+		assert.Error(err, "metadata %s should be invalid", test.metadata)
+		if err != nil {
+			assert.Contains(err.Error(), test.want)
+		}
+	}
+}
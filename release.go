@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Targets which weren't probed for this long are forgotten.
+	releaseTrackerTTL = 24 * time.Hour
+	// The least recently probed targets are forgotten above this number of targets.
+	releaseTrackerMaxTargets = 10000
+)
+
+var releases = newReleaseTracker(releaseTrackerTTL, releaseTrackerMaxTargets)
+
+type releaseState struct {
+	tag       string
+	changes   float64
+	changedAt time.Time
+	lastSeen  time.Time
+}
+
+// releaseTracker remembers the last ReleaseTag of the probed targets to detect deployments.
+type releaseTracker struct {
+	sync.Mutex
+	ttl        time.Duration
+	maxTargets int
+	targets    map[string]*releaseState
+	now        func() time.Time
+}
+
+func newReleaseTracker(ttl time.Duration, maxTargets int) *releaseTracker {
+	return &releaseTracker{
+		ttl:        ttl,
+		maxTargets: maxTargets,
+		targets:    map[string]*releaseState{},
+		now:        time.Now,
+	}
+}
+
+// observe records the release tag of the target and returns a copy of its state.
+// The change time of a target which didn't change yet is zero, the first observation isn't a deployment.
+func (t *releaseTracker) observe(target string, tag string) releaseState {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	t.expire(now)
+
+	state, ok := t.targets[target]
+	if !ok {
+		t.evict()
+		state = &releaseState{tag: tag}
+		t.targets[target] = state
+	} else if state.tag != tag {
+		state.tag = tag
+		state.changes++
+		state.changedAt = now
+	}
+	state.lastSeen = now
+	return *state
+}
+
+// expire removes the targets which weren't probed within the TTL.
+func (t *releaseTracker) expire(now time.Time) {
+	for target, state := range t.targets {
+		if now.Sub(state.lastSeen) > t.ttl {
+			delete(t.targets, target)
+		}
+	}
+}
+
+// evict removes the least recently probed targets to make room for a new one.
+func (t *releaseTracker) evict() {
+	for len(t.targets) >= t.maxTargets && len(t.targets) > 0 {
+		var oldest string
+		var oldestSeen time.Time
+		for target, state := range t.targets {
+			if oldest == "" || state.lastSeen.Before(oldestSeen) {
+				oldest, oldestSeen = target, state.lastSeen
+			}
+		}
+		delete(t.targets, oldest)
+	}
+}
+
+// collect observes the release tag of the target and sends the deployment tracking metrics.
+func (t *releaseTracker) collect(target string, tag string, ch chan<- prometheus.Metric) error {
+	state := t.observe(target, tag)
+
+	changes, err := createPrometheusMetric("commonstatus_release_changes_total", "Number of ReleaseTag changes observed by the exporter", state.changes, prometheus.CounterValue)
+	if err != nil {
+		return err
+	}
+
+	ch <- changes
+
+	// restarts of the exporter and newly probed targets would look like deployments, so the time is only
+	// sent once a change was observed
+	if state.changedAt.IsZero() {
+		return nil
+	}
+
+	changedAt, err := createPrometheusMetric("commonstatus_release_change_timestamp_seconds", "Time of the last observed ReleaseTag change, not sent before the first change", float64(state.changedAt.UnixNano())/1e9, prometheus.GaugeValue)
+	if err != nil {
+		return err
+	}
+
+	ch <- changedAt
+	return nil
+}
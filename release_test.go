@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseTracker_changes(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1548685443, 0)
+	tracker := newReleaseTracker(time.Hour, 10)
+	tracker.now = func() time.Time { return now }
+
+	type testpair struct {
+		tag       string
+		changes   float64
+		changedAt time.Time
+	}
+
+	start := now
+	tests := []testpair{
+		{"release-2019-01-21-A", 0, time.Time{}},
+		{"release-2019-01-21-A", 0, time.Time{}},
+		{"release-2019-01-28-A", 1, start.Add(2 * time.Minute)},
+		{"release-2019-01-21-A", 2, start.Add(3 * time.Minute)},
+		{"release-2019-01-21-A", 2, start.Add(3 * time.Minute)},
+	}
+
+	for _, test := range tests {
+		state := tracker.observe("http://catalog:8081", test.tag)
+		assert.Equal(test.tag, state.tag)
+		assert.Equal(test.changes, state.changes, "changes of %s", test.tag)
+		assert.Equal(test.changedAt, state.changedAt, "change time of %s", test.tag)
+		now = now.Add(time.Minute)
+	}
+}
+
+func TestReleaseTracker_expire(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1548685443, 0)
+	tracker := newReleaseTracker(time.Hour, 10)
+	tracker.now = func() time.Time { return now }
+
+	tracker.observe("http://old:8081", "a")
+	tracker.observe("http://catalog:8081", "a")
+	now = now.Add(50 * time.Minute)
+	tracker.observe("http://catalog:8081", "b")
+	now = now.Add(20 * time.Minute)
+
+	state := tracker.observe("http://old:8081", "b")
+	assert.Equal(float64(0), state.changes, "expired target should be tracked from scratch")
+	assert.Len(tracker.targets, 2)
+	assert.Equal(float64(1), tracker.targets["http://catalog:8081"].changes)
+}
+
+func TestReleaseTracker_evict(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1548685443, 0)
+	tracker := newReleaseTracker(time.Hour, 3)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		tracker.observe(fmt.Sprintf("http://catalog-%d:8081", i), "a")
+		now = now.Add(time.Second)
+	}
+
+	assert.Len(tracker.targets, 3)
+	for _, target := range []string{"http://catalog-2:8081", "http://catalog-3:8081", "http://catalog-4:8081"} {
+		assert.Contains(tracker.targets, target)
+	}
+}
+
+func TestReleaseTracker_collect(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1548685443, 0)
+	tracker := newReleaseTracker(time.Hour, 10)
+	tracker.now = func() time.Time { return now }
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	err := tracker.collect("http://catalog:8081", "a", ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	compareMetrics(t, prometheus.MustNewConstMetric(
+		prometheus.NewDesc("commonstatus_release_changes_total", "Number of ReleaseTag changes observed by the exporter", nil, nil),
+		prometheus.CounterValue,
+		0,
+	), <-ch)
+	assert.Len(ch, 0, "the first observation of a target isn't a change")
+
+	now = now.Add(time.Minute)
+	err = tracker.collect("http://catalog:8081", "b", ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	compareMetrics(t, prometheus.MustNewConstMetric(
+		prometheus.NewDesc("commonstatus_release_changes_total", "Number of ReleaseTag changes observed by the exporter", nil, nil),
+		prometheus.CounterValue,
+		1,
+	), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(
+		prometheus.NewDesc("commonstatus_release_change_timestamp_seconds", "Time of the last observed ReleaseTag change, not sent before the first change", nil, nil),
+		prometheus.GaugeValue,
+		float64(now.Unix()),
+	), <-ch)
+}
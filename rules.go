@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const rulesPriority = 50
+
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricType is a type of the prometheus metric created by a conversion rule.
+type MetricType string
+
+// Supported metric types of the conversion rules.
+const (
+	GaugeMetricType   MetricType = "gauge"
+	CounterMetricType MetricType = "counter"
+	UntypedMetricType MetricType = "untyped"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (t *MetricType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	switch metricType := MetricType(s); metricType {
+	case GaugeMetricType, CounterMetricType, UntypedMetricType:
+		*t = metricType
+		return nil
+	default:
+		return fmt.Errorf("unknown type: %s", s)
+	}
+}
+
+func (t MetricType) valueType() prometheus.ValueType {
+	switch t {
+	case GaugeMetricType:
+		return prometheus.GaugeValue
+	case CounterMetricType:
+		return prometheus.CounterValue
+	default:
+		return prometheus.UntypedValue
+	}
+}
+
+// ConversionRule converts CommonStatus lines matching a regular expression to a prometheus metric.
+// The name and the labels are templates which can reference groups of the expression, e.g. $1 or ${name}.
+type ConversionRule struct {
+	Match Regexp     `yaml:"match"`
+	Name  string     `yaml:"name"`
+	Help  string     `yaml:"help,omitempty"`
+	Type  MetricType `yaml:"type,omitempty"`
+	// Name of the group which contains the value, defaults to "value".
+	Value string `yaml:"value,omitempty"`
+	// The parsed value is multiplied by the scale, defaults to 1.
+	Scale  float64           `yaml:"scale,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *ConversionRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*r = ConversionRule{
+		Type:  UntypedMetricType,
+		Value: "value",
+		Scale: 1,
+	}
+	type plain ConversionRule
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+
+	if r.Match.Regexp == nil {
+		return fmt.Errorf("conversion rule is missing 'match'")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("conversion rule %q is missing 'name'", r.Match.original)
+	}
+	if !hasGroup(r.Match.Regexp, r.Value) {
+		return fmt.Errorf("conversion rule %q has no group named %q", r.Match.original, r.Value)
+	}
+	for name := range r.Labels {
+		if !labelName.MatchString(name) {
+			return fmt.Errorf("conversion rule %q has invalid label name: %s", r.Match.original, name)
+		}
+	}
+	return nil
+}
+
+// rulesConverter applies the conversion rules of a module, the first matching rule wins.
+type rulesConverter struct {
+	rules  []ConversionRule
+	values valueParser
+}
+
+func init() {
+	RegisterConverter("rules", rulesPriority, func(cfg ConversionConfig) Converter {
+		return rulesConverter{rules: cfg.Rules, values: valueParser{cfg: cfg.Values}}
+	})
+}
+
+func (c rulesConverter) Match(metric string) bool {
+	for _, rule := range c.rules {
+		if rule.Match.MatchString(metric) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c rulesConverter) Convert(metric string, ch chan<- prometheus.Metric) error {
+	for _, rule := range c.rules {
+		if rule.Match.MatchString(metric) {
+			return rule.convert(metric, c.values, ch)
+		}
+	}
+	return fmt.Errorf("no conversion rule matches the metric: %s", metric)
+}
+
+func (r ConversionRule) convert(metric string, values valueParser, ch chan<- prometheus.Metric) error {
+	match := r.Match.FindStringSubmatchIndex(metric)
+
+	value, err := values.parse(r.expand(metric, match, "${"+r.Value+"}"))
+	if err != nil {
+		return err
+	}
+
+	var labels prometheus.Labels
+	if len(r.Labels) > 0 {
+		labels = prometheus.Labels{}
+		for name, template := range r.Labels {
+			labels[name] = r.expand(metric, match, template)
+		}
+	}
+
+	promMetric, err := createPrometheusMetricWithLabels(r.expand(metric, match, r.Name), r.Help, value*r.Scale, labels, r.Type.valueType())
+	if err != nil {
+		return err
+	}
+
+	ch <- promMetric
+	return nil
+}
+
+func (r ConversionRule) expand(metric string, match []int, template string) string {
+	return string(r.Match.ExpandString(nil, template, metric, match))
+}
+
+func hasGroup(re *regexp.Regexp, name string) bool {
+	for _, group := range re.SubexpNames() {
+		if group == name && group != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestConversionRule_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := []ConversionRule{
+		{
+			Match:  MustNewRegexp(`Pool_(?P<pool>\w+)_(?P<kind>Active|Idle): (?P<value>[0-9,.]+)`),
+			Name:   "datasource_${kind}_connections",
+			Help:   "Connections of the pool",
+			Type:   GaugeMetricType,
+			Value:  "value",
+			Scale:  1,
+			Labels: map[string]string{"pool": "$pool"},
+		},
+		{
+			Match: MustNewRegexp(`QueueWait: (?P<ms>[0-9,.]+)ms`),
+			Name:  "queue_wait_seconds_total",
+			Type:  CounterMetricType,
+			Value: "ms",
+			Scale: 0.001,
+		},
+	}
+
+	type testpair struct {
+		metric string
+		want   prometheus.Metric
+	}
+
+	tests := []testpair{
+		{
+			"Pool_main_Active: 1,024",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("datasource_Active_connections", "Connections of the pool", nil, prometheus.Labels{"pool": "main"}),
+				prometheus.GaugeValue,
+				1024,
+			),
+		},
+		{
+			"QueueWait: 1,500ms",
+			prometheus.MustNewConstMetric(
+				prometheus.NewDesc("queue_wait_seconds_total", "", nil, nil),
+				prometheus.CounterValue,
+				1.5,
+			),
+		},
+	}
+
+	c := rulesConverter{rules: rules}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, 1)
+		defer close(ch)
+
+		assert.True(c.Match(test.metric))
+		err := c.Convert(test.metric, ch)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+
+		compareMetrics(t, test.want, <-ch)
+	}
+
+	assert.False(c.Match("ThreadCount: 3009"))
+}
+
+func TestConversionRule_precedesBuiltins(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := ConversionConfig{
+		Rules: []ConversionRule{
+			{Match: MustNewRegexp(`ThreadCount: (?P<value>.+)`), Name: "jvm_threads_current", Type: GaugeMetricType, Value: "value", Scale: 1},
+		},
+	}
+	converters := newConverters(cfg)
+	_, ok := defaultConversion("ThreadCount: 3009", converters)
+	assert.False(ok)
+	_, ok = defaultConversion("ThreadPeakCount: 4806", converters)
+	assert.True(ok)
+
+	ch := make(chan prometheus.Metric, 1)
+	defer close(ch)
+
+	err := convertMetric("ThreadCount: 3009", converters, ch)
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("jvm_threads_current", "", nil, nil), prometheus.GaugeValue, 3009), <-ch)
+}
+
+func TestConversionRule_unmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	var rule ConversionRule
+	err := yaml.UnmarshalStrict([]byte(`{match: "Foo: (?P<value>.+)", name: foo}`), &rule)
+	assert.NoError(err)
+	assert.Equal(UntypedMetricType, rule.Type)
+	assert.Equal("value", rule.Value)
+	assert.Equal(float64(1), rule.Scale)
+
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{`{name: foo}`, "missing 'match'"},
+		{`{match: "Foo: (?P<value>.+)"}`, "missing 'name'"},
+		{`{match: "Foo: (?P<value>.+)", name: foo, type: summary}`, "unknown type: summary"},
+		{`{match: "Foo: (.+)", name: foo}`, `no group named "value"`},
+		{`{match: "Foo: (?P<value>.+)", name: foo, labels: {"a-b": x}}`, "invalid label name: a-b"},
+	}
+
+	for _, test := range tests {
+		var rule ConversionRule
+		err := yaml.UnmarshalStrict([]byte(test.rule), &rule)
+		assert.Error(err, "rule %s should be invalid", test.rule)
+		if err != nil {
+			assert.Contains(err.Error(), test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const defaultSectionLabel = "section"
+
+var (
+	sectionHeader = regexp.MustCompile(`^\[\s*(.+?)\s*\]$`)
+	blockHeader   = regexp.MustCompile(`^([^\s:\[][^:]*):$`)
+)
+
+// sectionTracker keeps the section of the lines of a CommonStatus document. Lines after a [Section] header
+// belong to the section until the next header. Indented lines after a "Name:" line without a value belong
+// to the Name section, the block ends with the next line which is not indented deeper than the "Name:" line.
+// Blocks can be nested, the lines of a nested block belong to the innermost block only. A "Name:" line which
+// is not followed by a deeper indented line is a line with an empty value.
+type sectionTracker struct {
+	header string
+	blocks []sectionBlock
+}
+
+// sectionBlock is a "Name:" block header and the indentation of its line.
+type sectionBlock struct {
+	name   string
+	indent int
+}
+
+// next returns the line without its indentation if it belongs to a section and whether the line is
+// a section header, following is the line after it.
+func (t *sectionTracker) next(line string, following string) (string, bool) {
+	if strings.TrimSpace(line) == "" {
+		return line, false
+	}
+
+	indent := indentation(line)
+	for len(t.blocks) > 0 && t.blocks[len(t.blocks)-1].indent >= indent {
+		t.blocks = t.blocks[:len(t.blocks)-1]
+	}
+
+	trimmed := strings.Trim(line, " \t")
+	if m := sectionHeader.FindStringSubmatch(trimmed); m != nil && indent == 0 {
+		t.header = m[1]
+		return "", true
+	}
+	if m := blockHeader.FindStringSubmatch(trimmed); m != nil && strings.TrimSpace(following) != "" && indentation(following) > indent {
+		t.blocks = append(t.blocks, sectionBlock{name: m[1], indent: indent})
+		return "", true
+	}
+	if indent == 0 || t.section() == "" {
+		return line, false
+	}
+	return strings.TrimLeft(line, " \t"), false
+}
+
+// indentation returns the number of spaces and tabs the line starts with.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// section returns the section of the last line, the innermost block takes precedence over a [Section] header.
+func (t *sectionTracker) section() string {
+	if len(t.blocks) > 0 {
+		return t.blocks[len(t.blocks)-1].name
+	}
+	return t.header
+}
+
+// labels returns the labels of the lines in the section.
+func (s SectionsConfig) labels(section string) prometheus.Labels {
+	if section == "" {
+		return nil
+	}
+	if s.Label == "" {
+		return prometheus.Labels{defaultSectionLabel: section}
+	}
+	return prometheus.Labels{s.Label: section}
+}
+
+// labeledMetric adds labels to a metric created by a converter, the labels of the metric take precedence.
+type labeledMetric struct {
+	prometheus.Metric
+	labels prometheus.Labels
+}
+
+func (m labeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	for name, value := range m.labels {
+		if hasLabel(out.Label, name) {
+			continue
+		}
+		name, value := name, value
+		out.Label = append(out.Label, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sort.Slice(out.Label, func(i, j int) bool { return out.Label[i].GetName() < out.Label[j].GetName() })
+	return nil
+}
+
+func hasLabel(labels []*dto.LabelPair, name string) bool {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withLabels runs the conversion and sends the metrics it creates to ch with the labels added.
+func withLabels(labels prometheus.Labels, ch chan<- prometheus.Metric, convert func(ch chan<- prometheus.Metric) error) error {
+	if len(labels) == 0 {
+		return convert(ch)
+	}
+
+	lineCh := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lineCh)
+		errCh <- convert(lineCh)
+	}()
+	for m := range lineCh {
+		ch <- labeledMetric{Metric: m, labels: labels}
+	}
+	return <-errCh
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSectionTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		line     string
+		want     string
+		isHeader bool
+		section  string
+	}
+
+	tests := []testpair{
+		{"ThreadCount: 3009", "ThreadCount: 3009", false, ""},
+		{"  Indented: 1", "  Indented: 1", false, ""},
+		{"[Datasource main]", "", true, "Datasource main"},
+		{"Pool_Active: 5", "Pool_Active: 5", false, "Datasource main"},
+		{"Pools:", "", true, "Pools"},
+		{"  Pool_Idle: 3", "Pool_Idle: 3", false, "Pools"},
+		{"", "", false, "Pools"},
+		{"\tPool_Max: 10", "Pool_Max: 10", false, "Pools"},
+		{"Pool_Wait: 0", "Pool_Wait: 0", false, "Datasource main"},
+		{"[ Datasource reporting ]  ", "", true, "Datasource reporting"},
+		{"StartupTime: Mon Jan 2 15:04:05 UTC 2006", "StartupTime: Mon Jan 2 15:04:05 UTC 2006", false, "Datasource reporting"},
+		{"[]", "[]", false, "Datasource reporting"},
+		{"ReleaseTag: ", "ReleaseTag: ", false, "Datasource reporting"},
+		{"Comment:", "Comment:", false, "Datasource reporting"},
+		{"", "", false, "Datasource reporting"},
+		{"  Orphan: 1", "Orphan: 1", false, "Datasource reporting"},
+		{"Caches:", "", true, "Caches"},
+		{"\tCache_Size: 12", "Cache_Size: 12", false, "Caches"},
+		{"Pools:", "", true, "Pools"},
+		{"  main:", "", true, "main"},
+		{"    Active: 5", "Active: 5", false, "main"},
+		{"  reporting:", "", true, "reporting"},
+		{"    Active: 2", "Active: 2", false, "reporting"},
+		{"  Total: 7", "Total: 7", false, "Pools"},
+		{"Empty:", "Empty:", false, "Datasource reporting"},
+	}
+
+	tracker := &sectionTracker{}
+	for i, test := range tests {
+		following := ""
+		if i+1 < len(tests) {
+			following = tests[i+1].line
+		}
+		line, isHeader := tracker.next(test.line, following)
+		assert.Equal(test.want, line, "line: %q", test.line)
+		assert.Equal(test.isHeader, isHeader, "line: %q", test.line)
+		assert.Equal(test.section, tracker.section(), "line: %q", test.line)
+	}
+}
+
+func TestSectionsConfig_labels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(SectionsConfig{}.labels(""))
+	assert.Equal(prometheus.Labels{"section": "Pools"}, SectionsConfig{}.labels("Pools"))
+	assert.Equal(prometheus.Labels{"datasource": "main"}, SectionsConfig{Label: "datasource"}.labels("main"))
+}
+
+func TestWithLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	err := withLabels(prometheus.Labels{"section": "main", "pool": "ignored"}, ch, func(ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(prometheus.NewDesc("pool_active", "", nil, prometheus.Labels{"pool": "jdbc"}), prometheus.GaugeValue, 5)
+		return nil
+	})
+	assert.NoError(err)
+
+	m := dto.Metric{}
+	assert.NoError((<-ch).Write(&m))
+	assert.Len(m.Label, 2)
+	assert.Equal("pool", m.Label[0].GetName())
+	assert.Equal("jdbc", m.Label[0].GetValue(), "labels of the metric take precedence")
+	assert.Equal("section", m.Label[1].GetName())
+	assert.Equal("main", m.Label[1].GetValue())
+	assert.Equal(5.0, m.GetGauge().GetValue())
+}
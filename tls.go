@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// TLSConfig configures the TLS connection to the target.
+type TLSConfig struct {
+	// CA certificates used to verify the certificate of the target, the system roots are used if it's empty.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// Client certificate and key presented to the target.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// Name used to verify the certificate of the target, defaults to the host of the target.
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *TLSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TLSConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return fmt.Errorf("both cert_file and key_file must be configured")
+	}
+	return nil
+}
+
+func (s TLSConfig) isEmpty() bool {
+	return s == TLSConfig{}
+}
+
+// newTLSConfig reads the CA and the client certificate from their files.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		b, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in the CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// earliestCertExpiry returns the earliest expiry of the certificates presented by the target.
+func earliestCertExpiry(state *tls.ConnectionState) time.Time {
+	var earliest time.Time
+	for _, cert := range state.PeerCertificates {
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest
+}
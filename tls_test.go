@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to the directory.
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "commonstatus_exporter"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, cert
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commonstatus_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ThreadCount: 3009\n"))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	mtls := httptest.NewUnstartedServer(ts.Config.Handler)
+	mtls.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtls.StartTLS()
+	defer mtls.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caFile, "CERTIFICATE", ts.Certificate().Raw)
+
+	defer func(c *Config) { sc.C = c }(sc.C)
+	sc.C = &Config{
+		Modules: map[string]Module{
+			"no_ca":        {},
+			"ca":           {HTTP: HTTPProbe{TLSConfig: TLSConfig{CAFile: caFile}}},
+			"insecure":     {HTTP: HTTPProbe{TLSConfig: TLSConfig{InsecureSkipVerify: true}}},
+			"server_name":  {HTTP: HTTPProbe{TLSConfig: TLSConfig{CAFile: caFile, ServerName: "example.com"}}},
+			"wrong_name":   {HTTP: HTTPProbe{TLSConfig: TLSConfig{CAFile: caFile, ServerName: "status.internal"}}},
+			"client_cert":  {HTTP: HTTPProbe{TLSConfig: TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}}},
+			"missing_cert": {HTTP: HTTPProbe{TLSConfig: TLSConfig{CAFile: caFile, CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}}},
+		},
+	}
+
+	type testpair struct {
+		module string
+		target string
+		status int
+	}
+
+	tests := []testpair{
+		{"no_ca", ts.URL, http.StatusBadGateway},
+		{"ca", ts.URL, http.StatusOK},
+		{"insecure", ts.URL, http.StatusOK},
+		{"server_name", ts.URL, http.StatusOK},
+		{"wrong_name", ts.URL, http.StatusBadGateway},
+		{"ca", mtls.URL, http.StatusBadGateway},
+		{"client_cert", mtls.URL, http.StatusOK},
+		{"missing_cert", mtls.URL, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "?target="+test.target+"&module="+test.module, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probeHandler(w, r)
+		})
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("probe request handler returned wrong status code for module %s: %v, want %v", test.module, status, test.status)
+		}
+		if test.status == http.StatusOK && !strings.Contains(rr.Body.String(), "probe_ssl_earliest_cert_expiry ") {
+			t.Errorf("probe response of module %s should contain probe_ssl_earliest_cert_expiry, got: %s", test.module, rr.Body.String())
+		}
+	}
+}
+
+func TestEarliestCertExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	early, late := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{NotAfter: late}, {NotAfter: early}}}
+
+	assert.Equal(early, earliestCertExpiry(state))
+}
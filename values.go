@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+var (
+	durationValue   = regexp.MustCompile(`^(` + numberPattern + `)\s*(ns|us|µs|ms|s|sec|m|min|h|d)$`)
+	percentageValue = regexp.MustCompile(`^(` + numberPattern + `)\s*%$`)
+	numberValue     = regexp.MustCompile(`^` + numberPattern + `$`)
+	exponent        = regexp.MustCompile(`[eE][-+]?[0-9]+$`)
+)
+
+// numberFormat defines the separators of numbers printed by a service.
+type numberFormat struct {
+	decimal  string
+	grouping []string
+}
+
+// Number formats of the supported locales.
+var (
+	defaultNumberFormat = numberFormat{decimal: ".", grouping: []string{","}}
+	numberFormats       = map[string]numberFormat{
+		"en": defaultNumberFormat,
+		"de": {decimal: ",", grouping: []string{"."}},
+		"eu": {decimal: ",", grouping: []string{"."}},
+		"ch": {decimal: ".", grouping: []string{"'", "’"}},
+		"si": {decimal: ".", grouping: []string{"\u2009", "\u202f"}},
+	}
+)
+
+// parse parses a number with the separators of the format. The number may have a sign and an exponent,
+// NaN, Inf, +Inf and -Inf are accepted as well. The digits of the integer part must be grouped by three
+// if they are grouped at all. Values which consist of digits and separators but don't follow the format
+// are ambiguous, they are counted and not guessed.
+func (f numberFormat) parse(value string) (float64, error) {
+	switch strings.ToLower(value) {
+	case "nan":
+		return math.NaN(), nil
+	case "inf", "+inf", "infinity", "+infinity":
+		return math.Inf(1), nil
+	case "-inf", "-infinity":
+		return math.Inf(-1), nil
+	}
+
+	sign := ""
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign, value = value[:1], value[1:]
+	}
+	exp := exponent.FindString(value)
+	number, ok := f.normalize(strings.TrimSuffix(value, exp))
+	if !ok {
+		value = sign + value
+		if numberValue.MatchString(value) {
+			ambiguousValueCount.Inc()
+			level.Debug(logger).Log("msg", "ambiguous number, it doesn't match the number format", "value", value, "decimal_separator", f.decimal)
+			return 0, fmt.Errorf("can't parse metric, ambiguous value: %s", value)
+		}
+		return 0, fmt.Errorf("can't parse metric, invalid value: %s", value)
+	}
+	return strconv.ParseFloat(sign+number+exp, 64)
+}
+
+// normalize removes the grouping separators and replaces the decimal separator by a dot.
+func (f numberFormat) normalize(value string) (string, bool) {
+	parts := strings.Split(value, f.decimal)
+	if len(parts) > 2 {
+		return "", false
+	}
+
+	integer := parts[0]
+	for _, grouping := range f.grouping {
+		integer = strings.Replace(integer, grouping, "\x00", -1)
+	}
+	groups := strings.Split(integer, "\x00")
+	for i, group := range groups {
+		if !isDigits(group) || (len(groups) > 1 && (len(group) > 3 || (i > 0 && len(group) != 3))) {
+			return "", false
+		}
+	}
+
+	number := strings.Join(groups, "")
+	if len(parts) == 2 {
+		if !isDigits(parts[1]) {
+			return "", false
+		}
+		number += "." + parts[1]
+	}
+	return number, true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns":  time.Nanosecond,
+	"us":  time.Microsecond,
+	"µs":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"sec": time.Second,
+	"m":   time.Minute,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+var booleanValues = map[string]float64{
+	"true":  1,
+	"yes":   1,
+	"on":    1,
+	"false": 0,
+	"no":    0,
+	"off":   0,
+}
+
+// valueParser parses the values of CommonStatus lines, the kinds of values
+// in addition to plain numbers are enabled by the module.
+type valueParser struct {
+	cfg ValuesConfig
+}
+
+// number parses a plain number in the number format of the module.
+func (p valueParser) number(value string) (float64, error) {
+	return p.cfg.numberFormat().parse(value)
+}
+
+// parse tries plain numbers first, then durations, percentages, sizes and booleans.
+// Durations are checked before sizes, so 5m is 5 minutes if both are enabled.
+func (p valueParser) parse(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	format := p.cfg.numberFormat()
+	parsedValue, err := format.parse(value)
+	if err == nil || numberValue.MatchString(value) {
+		return parsedValue, err
+	}
+
+	if p.cfg.Durations {
+		if parsedValue, err := parseDuration(value, format); err == nil {
+			return parsedValue, nil
+		}
+	}
+	if p.cfg.Percentages {
+		if m := percentageValue.FindStringSubmatch(value); m != nil {
+			parsedValue, err := format.parse(m[1])
+			if err != nil {
+				return 0, err
+			}
+			return parsedValue / 100, nil
+		}
+	}
+	if p.cfg.Sizes {
+		if parsedValue, err := parseBytes(value, format); err == nil {
+			return parsedValue, nil
+		}
+	}
+	if p.cfg.Booleans {
+		if parsedValue, ok := booleanValues[strings.ToLower(value)]; ok {
+			return parsedValue, nil
+		}
+	}
+
+	return 0, fmt.Errorf("can't parse metric, invalid value: %s", value)
+}
+
+// parseDuration parses durations like 12ms or 1.5 h and compound durations like 1h30m to seconds.
+func parseDuration(value string, format numberFormat) (float64, error) {
+	if m := durationValue.FindStringSubmatch(value); m != nil {
+		parsedValue, err := format.parse(m[1])
+		if err != nil {
+			return 0, err
+		}
+		return parsedValue * durationUnits[m[2]].Seconds(), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
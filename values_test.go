@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueParser_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	p := valueParser{cfg: ValuesConfig{Durations: true, Sizes: true, Percentages: true, Booleans: true}}
+
+	type testpair struct {
+		value string
+		want  float64
+	}
+
+	var tests = []testpair{
+		{"1,234", 1234},
+		{"12ms", 0.012},
+		{"1,500 ms", 1.5},
+		{"250us", 0.00025},
+		{"3s", 3},
+		{"5m", 300},
+		{"2 min", 120},
+		{"1.5h", 5400},
+		{"1d", 86400},
+		{"1h30m", 5400},
+		{"93.5%", 0.935},
+		{"100 %", 1},
+		{"1.5 GB", 1.5 * 1024 * 1024 * 1024},
+		{"512KiB", 512 * 1024},
+		{"true", 1},
+		{"Yes", 1},
+		{"ON", 1},
+		{"false", 0},
+		{"no", 0},
+		{"off", 0},
+		{"-1.5e3", -1500},
+		{"-12ms", -0.012},
+		{"1e3 ms", 1},
+		{"-3.5%", -0.035},
+		{"+Inf", math.Inf(1)},
+		{"-Inf", math.Inf(-1)},
+	}
+
+	for _, test := range tests {
+		result, err := p.parse(test.value)
+		assert.NoError(err, "value: %s", test.value)
+		if err != nil {
+			continue
+		}
+
+		assert.InDelta(test.want, result, 1e-9, "value: %s", test.value)
+	}
+}
+
+func TestValueParser_disabled(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		cfg   ValuesConfig
+		value string
+	}
+
+	var tests = []testpair{
+		{ValuesConfig{}, "12ms"},
+		{ValuesConfig{}, "93.5%"},
+		{ValuesConfig{}, "1.2 GB"},
+		{ValuesConfig{}, "true"},
+		{ValuesConfig{Sizes: true, Percentages: true, Booleans: true}, "12ms"},
+		{ValuesConfig{Durations: true, Sizes: true, Booleans: true}, "93.5%"},
+		{ValuesConfig{Durations: true, Percentages: true, Booleans: true}, "1.2 GB"},
+		{ValuesConfig{Durations: true, Sizes: true, Percentages: true}, "true"},
+		{ValuesConfig{Durations: true, Sizes: true, Percentages: true, Booleans: true}, "maybe"},
+	}
+
+	for _, test := range tests {
+		_, err := valueParser{cfg: test.cfg}.parse(test.value)
+		assert.Error(err, "value %s should not be parsed with %+v", test.value, test.cfg)
+	}
+}
+
+func TestDefaultConverter_values(t *testing.T) {
+	assert := assert.New(t)
+
+	c := defaultConverter{values: valueParser{cfg: ValuesConfig{Percentages: true, Booleans: true}}}
+
+	ch := make(chan prometheus.Metric, 2)
+	defer close(ch)
+
+	assert.NoError(c.Convert("CacheHitRatio: 93.5%", ch))
+	assert.NoError(c.Convert("Maintenance: true", ch))
+
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("CacheHitRatio", "", nil, nil), prometheus.GaugeValue, 0.935), <-ch)
+	compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc("Maintenance", "", nil, nil), prometheus.GaugeValue, 1), <-ch)
+}
+
+func TestDefaultConverter_signedValues(t *testing.T) {
+	assert := assert.New(t)
+
+	c := defaultConverter{}
+
+	type testpair struct {
+		metric string
+		name   string
+		want   float64
+	}
+
+	var tests = []testpair{
+		{"TemperatureDelta: -1.5", "TemperatureDelta", -1.5},
+		{"Balance: -1,234.5", "Balance", -1234.5},
+		{"ErrorRate: 1.2e-3", "ErrorRate", 0.0012},
+		{"NextExpiry: +Inf", "NextExpiry", math.Inf(1)},
+	}
+
+	ch := make(chan prometheus.Metric, len(tests)+1)
+	defer close(ch)
+
+	for _, test := range tests {
+		assert.NoError(c.Convert(test.metric, ch), "metric: %s", test.metric)
+		compareMetrics(t, prometheus.MustNewConstMetric(prometheus.NewDesc(test.name, "", nil, nil), prometheus.GaugeValue, test.want), <-ch)
+	}
+
+	assert.NoError(c.Convert("LastValue: NaN", ch))
+	m := dto.Metric{}
+	(<-ch).Write(&m)
+	assert.True(math.IsNaN(m.GetGauge().GetValue()))
+}
+
+func TestNumberFormat_locales(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		cfg   ValuesConfig
+		value string
+		want  float64
+	}
+
+	var tests = []testpair{
+		{ValuesConfig{}, "1,234.5", 1234.5},
+		{ValuesConfig{Locale: "en"}, "9,220,838,392", 9220838392},
+		{ValuesConfig{Locale: "de"}, "1.234,5", 1234.5},
+		{ValuesConfig{Locale: "eu"}, "9.220.838.392", 9220838392},
+		{ValuesConfig{Locale: "de"}, "0,25", 0.25},
+		{ValuesConfig{Locale: "ch"}, "1'234.5", 1234.5},
+		{ValuesConfig{Locale: "ch"}, "1’234’567", 1234567},
+		{ValuesConfig{Locale: "si"}, "1 234.5", 1234.5},
+		{ValuesConfig{Locale: "si"}, "1 234 567", 1234567},
+		{ValuesConfig{Locale: "de", GroupingSeparator: " "}, "1 234,5", 1234.5},
+		{ValuesConfig{DecimalSeparator: ",", GroupingSeparator: "'"}, "1'234,5", 1234.5},
+		{ValuesConfig{Locale: "de"}, "1234", 1234},
+		{ValuesConfig{Locale: "de"}, "-1.234,5", -1234.5},
+		{ValuesConfig{Locale: "de"}, "1,5e-3", 0.0015},
+		{ValuesConfig{Locale: "si"}, "-1\u2009234.5E2", -123450},
+	}
+
+	for _, test := range tests {
+		result, err := valueParser{cfg: test.cfg}.number(test.value)
+		assert.NoError(err, "value: %s", test.value)
+		assert.Equal(test.want, result, "value: %s, locale: %s", test.value, test.cfg.Locale)
+	}
+}
+
+func TestNumberFormat_ambiguous(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		cfg   ValuesConfig
+		value string
+	}
+
+	var tests = []testpair{
+		{ValuesConfig{}, "1,5"},
+		{ValuesConfig{}, "1.234.567"},
+		{ValuesConfig{}, "1,2345"},
+		{ValuesConfig{}, "1234,567"},
+		{ValuesConfig{Locale: "de"}, "1.5"},
+		{ValuesConfig{Locale: "de"}, "1,234,5"},
+		{ValuesConfig{Locale: "ch"}, "1,234.5"},
+		{ValuesConfig{Locale: "si"}, "1.234,5"},
+	}
+
+	for _, test := range tests {
+		before := counterValue(ambiguousValueCount)
+		_, err := valueParser{cfg: test.cfg}.parse(test.value)
+		assert.Error(err, "value: %s, locale: %s", test.value, test.cfg.Locale)
+		assert.Equal(before+1, counterValue(ambiguousValueCount), "value: %s, locale: %s", test.value, test.cfg.Locale)
+	}
+
+	before := counterValue(ambiguousValueCount)
+	_, err := valueParser{}.parse("1.2 beta")
+	assert.Error(err)
+	assert.Equal(before, counterValue(ambiguousValueCount), "only numbers are ambiguous")
+}
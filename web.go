@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// clientAuthTypes are the supported values of client_auth_type.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// unsupportedWebConfigKeys are the keys of the exporter-toolkit web config which aren't supported,
+// they are rejected instead of being reported as unknown fields.
+var unsupportedWebConfigKeys = map[string]bool{
+	"http_server_config": true,
+}
+
+// unsupportedTLSServerConfigKeys are the keys of the exporter-toolkit tls_server_config which aren't supported.
+var unsupportedTLSServerConfigKeys = map[string]bool{
+	"cert":                        true,
+	"key":                         true,
+	"min_version":                 true,
+	"max_version":                 true,
+	"cipher_suites":               true,
+	"curve_preferences":           true,
+	"prefer_server_cipher_suites": true,
+	"client_allowed_sans":         true,
+}
+
+// checkUnsupportedKeys returns an error if the YAML map contains one of the unsupported keys.
+func checkUnsupportedKeys(unmarshal func(interface{}) error, unsupported map[string]bool, section string) error {
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	for key := range keys {
+		if unsupported[key] {
+			return fmt.Errorf("%s of the exporter-toolkit %s is not supported", key, section)
+		}
+	}
+	return nil
+}
+
+// WebConfig protects the endpoints of the exporter, the file passed via --web.config.file
+// has a subset of the format of the web config of the Prometheus exporter-toolkit.
+type WebConfig struct {
+	TLSServerConfig *TLSServerConfig `yaml:"tls_server_config,omitempty"`
+	// Users allowed to access the endpoints with their bcrypt-hashed passwords.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users,omitempty"`
+
+	// dummyHash is checked for unknown users, it has the highest cost of the hashes of the users,
+	// otherwise the response time tells whether the user exists.
+	dummyHash []byte
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *WebConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := checkUnsupportedKeys(unmarshal, unsupportedWebConfigKeys, "web config"); err != nil {
+		return err
+	}
+	type plain WebConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	maxCost := 0
+	for user, hash := range s.BasicAuthUsers {
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return fmt.Errorf("invalid bcrypt hash of user %q: %s", user, err)
+		}
+		if cost > maxCost {
+			maxCost = cost
+		}
+	}
+	if len(s.BasicAuthUsers) == 0 {
+		return nil
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password of unknown users"), maxCost)
+	if err != nil {
+		return err
+	}
+	s.dummyHash = dummyHash
+	return nil
+}
+
+// TLSServerConfig configures TLS of the endpoints of the exporter.
+type TLSServerConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Policy of client certificates, defaults to NoClientCert like in the exporter-toolkit.
+	ClientAuthType string `yaml:"client_auth_type,omitempty"`
+	// CA certificates used to verify client certificates.
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *TLSServerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := checkUnsupportedKeys(unmarshal, unsupportedTLSServerConfigKeys, "tls_server_config"); err != nil {
+		return err
+	}
+	type plain TLSServerConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	if s.CertFile == "" || s.KeyFile == "" {
+		return fmt.Errorf("both cert_file and key_file must be configured")
+	}
+	if _, ok := clientAuthTypes[s.ClientAuthType]; s.ClientAuthType != "" && !ok {
+		return fmt.Errorf("unknown client_auth_type: %s", s.ClientAuthType)
+	}
+	clientAuth := s.clientAuth()
+	if s.ClientCAFile == "" && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return fmt.Errorf("client_auth_type %s requires client_ca_file", s.ClientAuthType)
+	}
+	if s.ClientCAFile != "" && clientAuth == tls.NoClientCert {
+		return fmt.Errorf("client_ca_file requires a client_auth_type other than NoClientCert")
+	}
+	return nil
+}
+
+func (s TLSServerConfig) clientAuth() tls.ClientAuthType {
+	if s.ClientAuthType == "" {
+		return tls.NoClientCert
+	}
+	return clientAuthTypes[s.ClientAuthType]
+}
+
+// tlsConfig reads the client CA, the certificate and the key are loaded by the server.
+func (s TLSServerConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: s.clientAuth(),
+	}
+	if s.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in the client CA file %s", s.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func loadWebConfig(file string) (*WebConfig, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading web config file: %s", err)
+	}
+
+	c := &WebConfig{}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("error parsing web config file: %s", err)
+	}
+	return c, nil
+}
+
+// handler requires basic auth for all endpoints if users are configured.
+func (c *WebConfig) handler(next http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok {
+			hash, known := c.BasicAuthUsers[user]
+			if !known {
+				hash = string(c.dummyHash)
+			}
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil && known {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="commonstatus_exporter"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// listenAndServe serves the handler over TLS if it's configured.
+func (c *WebConfig) listenAndServe(addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: c.handler(handler)}
+	if c.TLSServerConfig == nil {
+		return server.ListenAndServe()
+	}
+
+	tlsConfig, err := c.TLSServerConfig.tlsConfig()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS(c.TLSServerConfig.CertFile, c.TLSServerConfig.KeyFile)
+}
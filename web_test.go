@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestLoadWebConfig_ok(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := loadWebConfig("testdata/web_config_good.yml")
+	assert.NoError(err)
+	if err != nil {
+		return
+	}
+
+	assert.Equal("/etc/commonstatus_exporter/server.crt", c.TLSServerConfig.CertFile)
+	assert.Equal(tls.RequireAndVerifyClientCert, c.TLSServerConfig.clientAuth())
+	assert.Len(c.BasicAuthUsers, 1)
+	assert.Equal(tls.NoClientCert, TLSServerConfig{}.clientAuth())
+}
+
+func TestLoadWebConfig_invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	type testpair struct {
+		file string
+		want string
+	}
+
+	tests := []testpair{
+		{"testdata/web_config_plain_password.yml", `invalid bcrypt hash of user "prometheus"`},
+		{"testdata/web_config_missing_key_file.yml", "both cert_file and key_file must be configured"},
+		{"testdata/web_config_missing_client_ca.yml", "client_auth_type RequireAndVerifyClientCert requires client_ca_file"},
+		{"testdata/web_config_unknown_client_auth.yml", "unknown client_auth_type: Always"},
+		{"testdata/web_config_client_ca_without_auth.yml", "client_ca_file requires a client_auth_type"},
+		{"testdata/web_config_min_version.yml", "min_version of the exporter-toolkit tls_server_config is not supported"},
+		{"testdata/web_config_http_server_config.yml", "http_server_config of the exporter-toolkit web config is not supported"},
+		{"testdata/web_config_missing.yml", "error reading web config file"},
+	}
+
+	for _, test := range tests {
+		_, err := loadWebConfig(test.file)
+		assert.Error(err, "file: %s", test.file)
+		if err != nil {
+			assert.Contains(err.Error(), test.want)
+		}
+	}
+}
+
+func TestWebConfig_basicAuth(t *testing.T) {
+	c, err := loadWebConfig("testdata/web_config_good.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	type testpair struct {
+		user     string
+		password string
+		status   int
+	}
+
+	tests := []testpair{
+		{"prometheus", "s3cret", http.StatusOK},
+		{"prometheus", "wrong", http.StatusUnauthorized},
+		{"admin", "s3cret", http.StatusUnauthorized},
+		{"admin", "dummy password of unknown users", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("handler returned wrong status code for user %q: %v, want %v", test.user, status, test.status)
+		}
+		if test.status == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("unauthorized response should contain the WWW-Authenticate header")
+		}
+	}
+}
+
+func TestWebConfig_clientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commonstatus_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, _ := writeClientCert(t, dir)
+	cfg := TLSServerConfig{ClientAuthType: "RequireAndVerifyClientCert", ClientCAFile: certFile}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}}}}
+	resp, err := withCert.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request with a client certificate should succeed: %s", err)
+	}
+	resp.Body.Close()
+
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := withoutCert.Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("request without a client certificate should fail")
+	}
+
+	if _, err := (TLSServerConfig{ClientCAFile: filepath.Join(dir, "missing.crt")}).tlsConfig(); err == nil || !strings.Contains(err.Error(), "can't read the client CA file") {
+		t.Errorf("missing client CA file should fail, got: %v", err)
+	}
+}
+
+func TestWebConfig_dummyHash(t *testing.T) {
+	content := "basic_auth_users:\n"
+	for user, cost := range map[string]int{"prometheus": bcrypt.MinCost + 1, "admin": bcrypt.MinCost} {
+		hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content += "  " + user + ": " + string(hash) + "\n"
+	}
+
+	c := &WebConfig{}
+	if err := yaml.UnmarshalStrict([]byte(content), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid hash would fail fast and reveal unknown users by the response time.
+	cost, err := bcrypt.Cost(c.dummyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != bcrypt.MinCost+1 {
+		t.Errorf("dummy password hash has cost %d, want the highest cost of the users %d", cost, bcrypt.MinCost+1)
+	}
+}